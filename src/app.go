@@ -4,15 +4,18 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"runtime"
 	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/deckarep/golang-set"
+	"github.com/juju/errors"
 	"github.com/rcrowley/go-metrics"
-	"github.com/vrischmann/go-metrics-influxdb"
 	"golang.org/x/net/context"
 )
 
@@ -20,84 +23,89 @@ type App struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	Config *Config
-	Flows  map[string][]*Flow
+	ConfigPath string
+
+	// Config, Flows and streams are only modified by Run.
+	// Other goroutines must hold lock to read them.
+	Config  *Config
+	Flows   map[StreamId][]*Flow
+	streams map[string]Streams
+	lock    sync.RWMutex
+
+	hooks *Webhooks
+
+	reload chan *Config
+}
+
+// StreamId identifies a stream. Server is empty if there's only one.
+type StreamId struct {
+	Server string
+	Stream string
+}
+
+// Fields returns the log fields describing the stream.
+func (id StreamId) Fields() log.Fields {
+	fields := log.Fields{"stream": id.Stream}
+	if id.Server != "" {
+		fields["server"] = id.Server
+	}
+	return fields
 }
 
-func NewApp(ctx context.Context, config *Config) *App {
+func NewApp(ctx context.Context, configPath string, config *Config) *App {
 	appCtx, cancel := context.WithCancel(ctx)
 
 	return &App{
 		ctx:    appCtx,
 		cancel: cancel,
 
-		Config: config,
-		Flows:  make(map[string][]*Flow),
+		ConfigPath: configPath,
+		Config:     config,
+		Flows:      make(map[StreamId][]*Flow),
+		streams:    make(map[string]Streams),
+
+		hooks: NewWebhooks(config.Webhooks),
+
+		reload: make(chan *Config),
 	}
 }
 
 func (app *App) Run() error {
 	go app.handleSigint()
 	go app.handleSigusr1()
+	go app.handleSighup()
 
 	if app.Config.Times.IdleTime > 0 {
 		go ShowIdleness(app.Config.Times.IdleTime)
 	}
 
-	if app.Config.Metrics.Influx != nil {
-		go influxdb.InfluxDB(
-			metrics.DefaultRegistry,
-			10*time.Second,
-			app.Config.Metrics.Influx.Host,
-			app.Config.Metrics.Influx.Database,
-			app.Config.Metrics.Influx.Username,
-			app.Config.Metrics.Influx.Password,
-		)
+	if err := app.startHttp(); err != nil {
+		return err
 	}
 
-	prevStreams := mapset.NewSet()
-	server := app.Config.Server.NewServer(app.Config)
+	if app.Config.Metrics.Influx != nil {
+		go ReportInflux(app.ctx, metrics.DefaultRegistry, 10*time.Second, app.Config.Metrics.Influx)
+	}
 
-	ticker := TickNow(app.Config.Times.ServerPollInterval)
-	resetTimer := NewRestartableTimer(app.Config.Times.ServerTimeout)
+	updates := make(chan streamsUpdate)
+	pollers := app.startPollers(app.Config.Servers, nil, updates)
 
-	numStreamsMetric := metrics.GetOrRegister("streams", metrics.NewGauge()).(metrics.Gauge)
 	for {
 		select {
-		case <-resetTimer.C:
-			log.Warn("No reply from server, assuming all streams gone")
-			resetTimer.Stop()
-			for stream := range prevStreams.Iter() {
-				app.removeStream(stream.(string))
-			}
-			prevStreams = mapset.NewSet()
-
-		case <-ticker:
-			curStreams, err := server.GetActiveStreams()
-			if err != nil {
-				Catch(err)
-				continue
-			}
-			resetTimer.Restart()
+		case update := <-updates:
+			app.updateStreams(update.server, update.streams)
 
-			numStreamsMetric.Update(int64(curStreams.Cardinality()))
-
-			for stream := range curStreams.Difference(prevStreams).Iter() {
-				app.addStream(stream.(string))
-			}
-			for stream := range prevStreams.Difference(curStreams).Iter() {
-				app.removeStream(stream.(string))
-			}
-
-			// All streams gone? => Good time for a GC run
-			if prevStreams.Cardinality() > 0 && curStreams.Cardinality() == 0 {
-				debug.FreeOSMemory()
-			}
-
-			prevStreams = curStreams
+		case config := <-app.reload:
+			app.hooks.Update(config.Webhooks)
+			servers := stopPollers(pollers)
+			app.removeServers(config.Servers, servers)
+			app.applyConfig(config)
+			pollers = app.startPollers(config.Servers, servers, updates)
 
 		case <-app.ctx.Done():
-			resetTimer.Stop()
+			for _, server := range stopPollers(pollers) {
+				closeServer(server)
+			}
 			for _, flows := range app.Flows {
 				for _, flow := range flows {
 					flow.Stop()
@@ -108,47 +116,170 @@ func (app *App) Run() error {
 	}
 }
 
-func (app *App) addStream(stream string) {
+// startPollers starts polling the configured servers.
+//
+// Servers of the previous configuration (by name) are reused if they can be
+// reconfigured, or replaced.
+func (app *App) startPollers(configs []*ServerConfig, servers map[string]Server, updates chan<- streamsUpdate) []*poller {
+	pollers := make([]*poller, 0, len(configs))
+	for _, config := range configs {
+		p := newPoller(config, replaceServer(servers[config.Name], config), updates)
+		p.Start(app.ctx)
+		pollers = append(pollers, p)
+	}
+	return pollers
+}
+
+// removeServers closes the servers that are no longer configured
+// and removes their streams.
+func (app *App) removeServers(configs []*ServerConfig, servers map[string]Server) {
+	for name, server := range servers {
+		if hasServer(configs, name) {
+			continue
+		}
+
+		closeServer(server)
+		app.updateStreams(name, make(Streams))
+		app.lock.Lock()
+		delete(app.streams, name)
+		app.lock.Unlock()
+	}
+}
+
+// stopPollers stops polling and returns the servers by name.
+func stopPollers(pollers []*poller) map[string]Server {
+	servers := make(map[string]Server, len(pollers))
+	for _, p := range pollers {
+		servers[p.config.Name] = p.Stop()
+	}
+	return servers
+}
+
+// updateStreams starts and stops flows for the streams of a server
+// that appeared or disappeared.
+func (app *App) updateStreams(server string, curStreams Streams) {
+	prevStreams := app.streams[server]
+
+	labels := MetricLabels{}
+	if server != "" {
+		labels["server"] = server
+	}
+	numStreamsMetric := metrics.GetOrRegister(labels.Name("streams"), metrics.NewGauge()).(metrics.Gauge)
+	numStreamsMetric.Update(int64(len(curStreams)))
+
+	for stream, metadata := range curStreams {
+		prevMetadata, ok := prevStreams[stream]
+		if !ok {
+			app.addStream(StreamId{server, stream}, metadata)
+		} else if !prevMetadata.Equals(metadata) {
+			app.updateMetadata(StreamId{server, stream}, metadata)
+			app.startMatchingFlows(StreamId{server, stream}, metadata)
+		}
+	}
+	for stream := range prevStreams {
+		if _, ok := curStreams[stream]; !ok {
+			app.removeStream(StreamId{server, stream})
+		}
+	}
+
+	// All streams gone? => Good time for a GC run
+	if len(prevStreams) > 0 && len(curStreams) == 0 {
+		debug.FreeOSMemory()
+	}
+
+	app.lock.Lock()
+	app.streams[server] = curStreams
+	app.lock.Unlock()
+}
+
+func (app *App) addStream(stream StreamId, metadata Metadata) {
 	logged := false
 
 	for flowName, flowConfig := range app.Config.Flows {
-		if flowConfig.Regexp.MatchString(stream) {
+		if flowConfig.Matches(stream.Server, stream.Stream, metadata) {
 			if !logged {
 				logged = true
-				log.WithFields(log.Fields{
-					"stream": stream,
-					"match":  true,
-				}).Warn("New stream")
+				log.WithFields(stream.Fields()).WithField("match", true).Warn("New stream")
+				app.hooks.Send(Event{
+					Event:   EventStreamAdded,
+					Server:  stream.Server,
+					Stream:  stream.Stream,
+					Details: map[string]interface{}{"match": true},
+				})
 			}
 
-			app.addFlow(flowName, stream, flowConfig.Source, flowConfig.Sinks)
+			app.addFlow(flowName, stream, metadata, flowConfig)
 		}
 	}
 
 	if !logged {
-		log.WithFields(log.Fields{
-			"stream": stream,
-			"match":  false,
-		}).Debug("New stream, ignoring")
+		log.WithFields(stream.Fields()).WithField("match", false).Debug("New stream, ignoring")
+		app.hooks.Send(Event{
+			Event:   EventStreamAdded,
+			Server:  stream.Server,
+			Stream:  stream.Stream,
+			Details: map[string]interface{}{"match": false},
+		})
 	}
 }
 
-func (app *App) addFlow(name string, stream string, sourceTemplate CmdData, sinkTemplates map[string]CmdData) {
-	vars := map[string]string{
-		"{stream}": stream,
+// startMatchingFlows starts the flows that a stream whose metadata changed
+// matches only now. Servers often don't know the metadata of a stream yet
+// when it appears.
+func (app *App) startMatchingFlows(stream StreamId, metadata Metadata) {
+	for flowName, flowConfig := range app.Config.Flows {
+		if app.FindFlow(stream, flowName) == nil && flowConfig.Matches(stream.Server, stream.Stream, metadata) {
+			log.WithFields(stream.Fields()).WithField("name", flowName).Info("Stream metadata matches flow now")
+			app.addFlow(flowName, stream, metadata, flowConfig)
+		}
 	}
+}
+
+// updateMetadata restarts the flows of a stream whose tracked metadata fields
+// changed, compared to the metadata the flow was started with.
+//
+// Fields that are unknown now, or were unknown when the flow was started,
+// don't restart it; values that became known are compared from then on.
+func (app *App) updateMetadata(stream StreamId, metadata Metadata) {
+	for flowName, flowConfig := range app.Config.Flows {
+		flow := app.FindFlow(stream, flowName)
+		if flow == nil {
+			continue
+		}
 
-	source := sourceTemplate.Replace(vars)
-	sinks := make(map[string]CmdData, len(sinkTemplates))
-	for sinkName, sinkTemplate := range sinkTemplates {
-		sinks[sinkName] = sinkTemplate.Replace(vars)
+		changed := flow.metadata.Diff(metadata, flow.config.Misc.RestartOnMetadataChange)
+		if len(changed) == 0 {
+			for field, value := range metadata {
+				if flow.metadata[field] == "" {
+					flow.metadata[field] = value
+				}
+			}
+			continue
+		}
+
+		fields := log.Fields{}
+		for _, field := range changed {
+			fields[field] = fmt.Sprintf("%s -> %s", flow.metadata[field], metadata[field])
+		}
+		flow.log.WithFields(fields).Warn("Stream metadata changed, restarting flow")
+		app.removeFlow(stream, flowName)
+		if flowConfig.Matches(stream.Server, stream.Stream, metadata) {
+			app.addFlow(flowName, stream, metadata, flowConfig)
+		}
 	}
+}
 
-	flow := NewFlow(app.ctx, name, stream, app.Config, source, sinks, log.WithFields(log.Fields{
-		"name":   name,
-		"stream": stream,
-	}))
+func (app *App) addFlow(name string, stream StreamId, metadata Metadata, config *FlowConfig) {
+	vars := config.Variables(stream.Server, name, stream.Stream, metadata)
+	source, sinks := config.Commands(vars)
+
+	flow := NewFlow(app.ctx, name, stream, metadata, config, source, sinks,
+		log.WithFields(stream.Fields()).WithField("name", name), app.hooks)
 	flow.Start()
+	app.hooks.Send(Event{Event: EventFlowStarted, Server: stream.Server, Stream: stream.Stream, Flow: name})
+
+	app.lock.Lock()
+	defer app.lock.Unlock()
 
 	if _, ok := app.Flows[stream]; !ok {
 		app.Flows[stream] = make([]*Flow, 0, 1)
@@ -156,26 +287,195 @@ func (app *App) addFlow(name string, stream string, sourceTemplate CmdData, sink
 	app.Flows[stream] = append(app.Flows[stream], flow)
 }
 
-func (app *App) removeStream(stream string) {
+func (app *App) removeStream(stream StreamId) {
 	flows, ok := app.Flows[stream]
+	app.hooks.Send(Event{
+		Event:   EventStreamRemoved,
+		Server:  stream.Server,
+		Stream:  stream.Stream,
+		Details: map[string]interface{}{"match": ok},
+	})
 	if !ok {
-		log.WithFields(log.Fields{
-			"stream": stream,
-		}).Debug("Ignored stream gone")
+		log.WithFields(stream.Fields()).Debug("Ignored stream gone")
 
 		return
 	}
 
-	log.WithFields(log.Fields{
-		"stream": stream,
-	}).Warn("Stream gone")
+	log.WithFields(stream.Fields()).Warn("Stream gone")
 
 	for _, flow := range flows {
 		flow.log.Info("Stopping flow")
 		flow.Stop()
 	}
 
+	app.lock.Lock()
 	delete(app.Flows, stream)
+	app.lock.Unlock()
+}
+
+// applyConfig replaces the configuration of a running app.
+//
+// Flows whose configuration did not change are left running.
+// Flows that were removed or changed are stopped, and flows that
+// were added or changed are started for all matching active streams.
+//
+// The global settings that are only used at startup are not applied;
+// a warning tells that a restart is needed for them.
+func (app *App) applyConfig(config *Config) {
+	oldConfig := app.Config
+	warnRestartNeeded(oldConfig, config)
+	app.lock.Lock()
+	app.Config = config
+	app.lock.Unlock()
+
+	for flowName, oldFlowConfig := range oldConfig.Flows {
+		newFlowConfig, ok := config.Flows[flowName]
+		if ok && oldFlowConfig.Equals(newFlowConfig) {
+			continue
+		}
+		app.removeFlows(flowName)
+	}
+
+	for flowName, newFlowConfig := range config.Flows {
+		oldFlowConfig, ok := oldConfig.Flows[flowName]
+		if ok && oldFlowConfig.Equals(newFlowConfig) {
+			continue
+		}
+		for server, streams := range app.streams {
+			for stream, metadata := range streams {
+				if newFlowConfig.Matches(server, stream, metadata) {
+					app.addFlow(flowName, StreamId{server, stream}, metadata, newFlowConfig)
+				}
+			}
+		}
+	}
+}
+
+// warnRestartNeeded logs the settings that changed but are only used at startup.
+func warnRestartNeeded(oldConfig, newConfig *Config) {
+	if changed := restartNeeded(oldConfig, newConfig); len(changed) > 0 {
+		log.WithField("settings", strings.Join(changed, ", ")).
+			Warn("Settings changed that are only applied after a restart")
+	}
+}
+
+// restartNeeded returns the settings that changed but are only used at startup.
+func restartNeeded(oldConfig, newConfig *Config) []string {
+	changed := []string{}
+	if oldConfig.Debug != newConfig.Debug {
+		changed = append(changed, "debug")
+	}
+	if !reflect.DeepEqual(oldConfig.Metrics, newConfig.Metrics) {
+		changed = append(changed, "metrics")
+	}
+	if oldConfig.Http != newConfig.Http {
+		changed = append(changed, "http")
+	}
+	if oldConfig.Control != newConfig.Control {
+		changed = append(changed, "control")
+	}
+	if oldConfig.Times.IdleTime != newConfig.Times.IdleTime {
+		changed = append(changed, "times.idle_time")
+	}
+	return changed
+}
+
+// Status describes all flows, ordered by server, stream and flow name.
+//
+// Thread-safe.
+func (app *App) Status() []FlowStatus {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+
+	result := make([]FlowStatus, 0, len(app.Flows))
+	for _, flows := range app.Flows {
+		for _, flow := range flows {
+			result = append(result, flow.Status())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Server != result[j].Server {
+			return result[i].Server < result[j].Server
+		}
+		if result[i].Stream != result[j].Stream {
+			return result[i].Stream < result[j].Stream
+		}
+		return result[i].Flow < result[j].Flow
+	})
+	return result
+}
+
+// Streams describes the currently active streams.
+//
+// Thread-safe.
+func (app *App) Streams() StreamsReport {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+
+	return NewStreamsReport(app.Config, app.streams)
+}
+
+// Reload re-reads the configuration file and applies it, see applyConfig.
+//
+// Blocks until Run has received the new configuration.
+func (app *App) Reload() error {
+	log.WithField("path", app.ConfigPath).Info("Reloading configuration")
+
+	config, err := LoadConfig(app.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case app.reload <- config:
+		return nil
+	case <-app.ctx.Done():
+		return errors.New("shutting down")
+	}
+}
+
+// FindFlow returns the flow with the given name for a stream, or nil.
+//
+// Thread-safe.
+func (app *App) FindFlow(stream StreamId, name string) *Flow {
+	app.lock.RLock()
+	defer app.lock.RUnlock()
+
+	for _, flow := range app.Flows[stream] {
+		if flow.name == name {
+			return flow
+		}
+	}
+	return nil
+}
+
+// removeFlow stops the flow with the given name for a stream.
+func (app *App) removeFlow(stream StreamId, name string) {
+	remaining := make([]*Flow, 0, len(app.Flows[stream]))
+	for _, flow := range app.Flows[stream] {
+		if flow.name == name {
+			flow.log.Info("Stopping flow")
+			flow.Stop()
+		} else {
+			remaining = append(remaining, flow)
+		}
+	}
+
+	app.lock.Lock()
+	if len(remaining) == 0 {
+		delete(app.Flows, stream)
+	} else {
+		app.Flows[stream] = remaining
+	}
+	app.lock.Unlock()
+}
+
+// removeFlows stops all flows with the given name, regardless of stream.
+func (app *App) removeFlows(name string) {
+	for stream := range app.Flows {
+		app.removeFlow(stream, name)
+	}
 }
 
 func (app *App) handleSigint() {
@@ -190,6 +490,16 @@ func (app *App) handleSigint() {
 	}
 }
 
+func (app *App) handleSighup() {
+	channel := make(chan os.Signal, 1)
+	signal.Notify(channel, syscall.SIGHUP)
+	for range channel {
+		if err := app.Reload(); err != nil {
+			log.WithError(err).Warn("Failed to reload configuration, keeping old one")
+		}
+	}
+}
+
 func (app *App) handleSigusr1() {
 	channel := make(chan os.Signal, 1)
 	signal.Notify(channel, syscall.SIGUSR1)
@@ -0,0 +1,224 @@
+package autotee
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+const appTestConfig = `
+server:
+  type: "static"
+console:
+  type: "none"
+flows:
+  "hd":
+    regexp: "^s1$"
+    metadata:
+      height: "^1080$"
+    source: "sleep 60"
+    sinks: {}
+`
+
+func newAppForTest(t *testing.T, text string) *App {
+	var config Config
+	if err := yaml.Unmarshal([]byte(text), &config); err != nil {
+		t.Fatal(err)
+	}
+	return NewApp(context.Background(), "", &config)
+}
+
+func stopAppForTest(app *App) {
+	app.cancel()
+	for _, flows := range app.Flows {
+		for _, flow := range flows {
+			flow.Stop()
+		}
+	}
+}
+
+func TestAppMetadataMatchesLater(t *testing.T) {
+	app := newAppForTest(t, appTestConfig)
+	defer stopAppForTest(app)
+	s1 := StreamId{"", "s1"}
+
+	// No metadata yet, like nginx-rtmp right after publishing
+	app.updateStreams("", Streams{"s1": nil})
+	if app.FindFlow(s1, "hd") != nil {
+		t.Fatal("Flow should not have been started without metadata")
+	}
+
+	app.updateStreams("", Streams{"s1": {"height": "1080"}})
+	if app.FindFlow(s1, "hd") == nil {
+		t.Fatal("Flow should have been started once the metadata matched")
+	}
+}
+
+const appTestRestartConfig = `
+server:
+  type: "static"
+console:
+  type: "none"
+flows:
+  "any":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+    misc:
+      restart_on_metadata_change: [height]
+`
+
+func TestAppMetadataUnknownKeepsFlow(t *testing.T) {
+	app := newAppForTest(t, appTestRestartConfig)
+	defer stopAppForTest(app)
+	s1 := StreamId{"", "s1"}
+
+	app.updateStreams("", Streams{"s1": {"height": "1080"}})
+	flow := app.FindFlow(s1, "any")
+	if flow == nil {
+		t.Fatal("Flow should have been started")
+	}
+
+	// Encoder reconnects, the server briefly doesn't know the metadata
+	app.updateStreams("", Streams{"s1": nil})
+	app.updateStreams("", Streams{"s1": {"height": "1080"}})
+	if app.FindFlow(s1, "any") != flow {
+		t.Fatal("Flow should not have been restarted while the metadata was unknown")
+	}
+
+	app.updateStreams("", Streams{"s1": {"height": "720"}})
+	if restarted := app.FindFlow(s1, "any"); restarted == nil || restarted == flow {
+		t.Fatal("Flow should have been restarted after the height changed")
+	}
+}
+
+func TestAppMetadataLearnedAfterStart(t *testing.T) {
+	app := newAppForTest(t, appTestRestartConfig)
+	defer stopAppForTest(app)
+	s1 := StreamId{"", "s1"}
+
+	app.updateStreams("", Streams{"s1": nil})
+	flow := app.FindFlow(s1, "any")
+	if flow == nil {
+		t.Fatal("Flow should have been started")
+	}
+
+	app.updateStreams("", Streams{"s1": {"height": "1080"}})
+	if app.FindFlow(s1, "any") != flow {
+		t.Fatal("Flow should not have been restarted when the height became known")
+	}
+
+	app.updateStreams("", Streams{"s1": {"height": "720"}})
+	if restarted := app.FindFlow(s1, "any"); restarted == nil || restarted == flow {
+		t.Fatal("Flow should have been restarted after the height changed")
+	}
+}
+
+const appTestReloadConfig = `
+server:
+  type: "static"
+console:
+  type: "none"
+flows:
+  "keep":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+  "change":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+  "remove":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+`
+
+const appTestReloadedConfig = `
+server:
+  type: "static"
+console:
+  type: "none"
+flows:
+  "keep":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+  "change":
+    regexp: "^s1$"
+    source: "sleep 61"
+    sinks: {}
+  "add":
+    regexp: "^s1$"
+    source: "sleep 60"
+    sinks: {}
+`
+
+func parseConfigForTest(t *testing.T, text string) *Config {
+	var config Config
+	if err := yaml.Unmarshal([]byte(text), &config); err != nil {
+		t.Fatal(err)
+	}
+	return &config
+}
+
+func TestAppApplyConfig(t *testing.T) {
+	app := newAppForTest(t, appTestReloadConfig)
+	defer stopAppForTest(app)
+	s1 := StreamId{"", "s1"}
+
+	app.updateStreams("", Streams{"s1": nil})
+	keep, change := app.FindFlow(s1, "keep"), app.FindFlow(s1, "change")
+	if keep == nil || change == nil || app.FindFlow(s1, "remove") == nil {
+		t.Fatal("Flows should have been started")
+	}
+
+	app.applyConfig(parseConfigForTest(t, appTestReloadedConfig))
+
+	if app.FindFlow(s1, "keep") != keep {
+		t.Error("Unchanged flow should have been kept running")
+	}
+	if changed := app.FindFlow(s1, "change"); changed == nil || changed == change {
+		t.Error("Changed flow should have been restarted")
+	}
+	if app.FindFlow(s1, "remove") != nil {
+		t.Error("Removed flow should have been stopped")
+	}
+	if app.FindFlow(s1, "add") == nil {
+		t.Error("Added flow should have been started for the active stream")
+	}
+}
+
+func TestAppApplyConfigRestartNeeded(t *testing.T) {
+	app := newAppForTest(t, appTestReloadConfig)
+	defer stopAppForTest(app)
+	s1 := StreamId{"", "s1"}
+
+	app.updateStreams("", Streams{"s1": nil})
+	keep := app.FindFlow(s1, "keep")
+
+	config := parseConfigForTest(t, appTestReloadConfig+`
+debug: true
+metrics:
+  influx:
+    host: "http://localhost:8086"
+    database: "autotee"
+http:
+  listen: "localhost:8080"
+control:
+  socket: "/run/autotee.sock"
+times:
+  idle_time: 60
+`)
+	expected := []string{"debug", "metrics", "http", "control", "times.idle_time"}
+	if changed := restartNeeded(app.Config, config); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Settings needing a restart were %#v, expected %#v", changed, expected)
+	}
+
+	app.applyConfig(config)
+	if app.FindFlow(s1, "keep") != keep {
+		t.Error("Flow should not have been restarted for settings only used at startup")
+	}
+}
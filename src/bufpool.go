@@ -86,6 +86,11 @@ func (bp *BufPool) IsFull() bool {
 	return atomic.LoadInt32(&bp.avail) == bp.max
 }
 
+// Returns the number of buffers currently in use and the total number of buffers.
+func (bp *BufPool) Usage() (used, total int) {
+	return int(bp.max - atomic.LoadInt32(&bp.avail)), int(bp.max)
+}
+
 // Must be called after the buffer has been received from the pool.
 //
 // Passing a negative value causes panic.
@@ -3,7 +3,10 @@ package autotee
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,27 +18,91 @@ import (
 
 type Config struct {
 	Debug        bool
-	Server       ServerConfig
+	Servers      []*ServerConfig
 	Metrics      MetricsConfig
+	Http         HttpConfig
+	Control      ControlConfig
 	SourceBuffer BufferPoolConfig
 	SinkBuffer   BufferConfig
-	Flows        map[string]FlowConfig
+	Flows        map[string]*FlowConfig
 	Times        TimeConfig
 	Misc         MiscConfig
+	Console      ConsoleConfig
+	Webhooks     []WebhookConfig
 }
 
+// ServerConfig describes a server to get streams from.
+//
+// PollInterval, RequestTimeout and Timeout default to the server_* settings
+// of the times section.
 type ServerConfig struct {
+	Name      string
 	NewServer ServerFactory
+	Type      string
 	Url       string
 	App       string
 	XPath     *xmlpath.Path
 	Streams   mapset.Set
+
+	// For srs servers
+	Vhost string
+
+	// For mediamtx servers
+	SourceTypes []string
+
+	// For icecast servers
+	MountPrefix  string
+	ContentTypes []string
+	NameField    string
+
+	// For nginx-rtmp-push servers
+	Listen            string
+	ReconcileInterval time.Duration
+
+	// For command servers
+	Command CmdData
+	Format  string
+
+	// For file and directory servers
+	Path string
+
+	PollInterval   time.Duration
+	RequestTimeout time.Duration
+	Timeout        time.Duration
+
+	// Own settings, nil if not set.
+	pollInterval, requestTimeout, timeout *int
 }
 
 type MetricsConfig struct {
 	Influx *InfluxConfig `yaml:"influx"`
 }
 
+// HttpConfig configures the built-in HTTP server.
+// It serves metrics at /metrics in the Prometheus text format
+// and the state of all flows at /status as JSON.
+type HttpConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// ControlConfig configures the control socket.
+// It serves the same as the HTTP server, plus commands to
+// restart, disable and enable flows and sinks at runtime.
+type ControlConfig struct {
+	Socket string `yaml:"socket"`
+}
+
+// WebhookConfig configures a URL that events are POSTed to, see Webhooks.
+// Without events, it receives all events. Name is optional, it is used
+// in logs and metrics instead of the URL, which may contain secrets.
+type WebhookConfig struct {
+	Name      string
+	Url       string
+	Events    []string
+	Timeout   time.Duration
+	QueueSize int
+}
+
 type InfluxConfig struct {
 	Host     string `yaml:"host"`
 	Database string `yaml:"database"`
@@ -52,70 +119,286 @@ type BufferPoolConfig struct {
 	BufferSize  int `yaml:"buffer_size"`
 }
 
+// FlowConfig describes a flow.
+//
+// Times, SourceBuffer, SinkBuffer, Misc and Console hold the resolved settings
+// for this flow: the global settings, with the flows own overrides applied.
 type FlowConfig struct {
-	Regexp *regexp.Regexp
-	Source CmdData
-	Sinks  map[string]CmdData
+	Regexp       *regexp.Regexp
+	Servers      []string
+	Metadata     map[string]*regexp.Regexp
+	Source       CmdData
+	Sinks        map[string]CmdData
+	Times        TimeConfig
+	SourceBuffer BufferPoolConfig
+	SinkBuffer   BufferConfig
+	Misc         MiscConfig
+	Console      ConsoleConfig
+
+	overrides flowOverrides
+}
+
+// Raw per-flow settings sections, applied on top of the global ones.
+type flowOverrides struct {
+	Times        yaml.MapSlice `yaml:"times"`
+	SourceBuffer yaml.MapSlice `yaml:"source_buffer"`
+	SinkBuffer   yaml.MapSlice `yaml:"sink_buffer"`
+	Misc         yaml.MapSlice `yaml:"misc"`
+	Console      yaml.MapSlice `yaml:"console"`
 }
 
 type TimeConfig struct {
 	SourceRestartDelay   time.Duration
 	SourceTimeout        time.Duration
 	SinkRestartDelay     time.Duration
+	RestartMaxDelay      time.Duration
+	RestartHealthyTime   time.Duration
+	GiveUpWindow         time.Duration
 	ServerPollInterval   time.Duration
 	ServerRequestTimeout time.Duration
 	ServerTimeout        time.Duration
 	IdleTime             time.Duration
 }
 
+// flowTimes returns the times without those that flows don't use:
+// the server_* times and idle_time.
+func (tc TimeConfig) flowTimes() TimeConfig {
+	tc.ServerPollInterval = 0
+	tc.ServerRequestTimeout = 0
+	tc.ServerTimeout = 0
+	tc.IdleTime = 0
+	return tc
+}
+
+// ConsoleConfig selects where the output (stderr) of processes goes.
+type ConsoleConfig struct {
+	Type        string `yaml:"type"`
+	LogDir      string `yaml:"log_dir"`
+	LogMaxSize  int64  `yaml:"log_max_size"`
+	LogMaxFiles int    `yaml:"log_max_files"`
+}
+
 type MiscConfig struct {
 	ReuseScreens        bool
 	RestartWhenSinkDies bool
+	RestartJitter       int
+	GiveUpFailures      int
+	StderrLines         int
+	RestartLoopFailures int
+
+	// Metadata fields that restart the flow when they change
+	RestartOnMetadataChange []string
 }
 
-var UseDefaults = func(interface{}) error { return nil }
+var DefaultTimeConfig = TimeConfig{
+	SourceRestartDelay:   3 * time.Second,
+	SourceTimeout:        3 * time.Second,
+	SinkRestartDelay:     3 * time.Second,
+	RestartMaxDelay:      0,
+	RestartHealthyTime:   30 * time.Second,
+	GiveUpWindow:         300 * time.Second,
+	ServerPollInterval:   5 * time.Second,
+	ServerRequestTimeout: 3 * time.Second,
+	ServerTimeout:        16 * time.Second,
+	IdleTime:             0,
+}
+
+var DefaultConsoleConfig = ConsoleConfig{
+	Type:        "screen",
+	LogDir:      "",
+	LogMaxSize:  10 * 1024 * 1024,
+	LogMaxFiles: 5,
+}
+
+var DefaultMiscConfig = MiscConfig{
+	ReuseScreens:        true,
+	RestartWhenSinkDies: false,
+	RestartJitter:       0,
+	GiveUpFailures:      0,
+	StderrLines:         200,
+	RestartLoopFailures: 3,
+}
 
 func (tc *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	aux := struct {
-		Debug        bool                  `yaml:"debug"`
-		Server       ServerConfig          `yaml:"server"`
-		Metrics      MetricsConfig         `yaml:"metrics"`
-		SourceBuffer BufferPoolConfig      `yaml:"source_buffer"`
-		SinkBuffer   BufferConfig          `yaml:"sink_buffer"`
-		Flows        map[string]FlowConfig `yaml:"flows"`
-		Times        TimeConfig            `yaml:"times"`
-		Misc         MiscConfig            `yaml:"misc"`
-	}{}
-
-	if err := aux.Times.UnmarshalYAML(UseDefaults); err != nil {
-		return err
-	}
-	if err := aux.Misc.UnmarshalYAML(UseDefaults); err != nil {
-		return err
+		Debug        bool                   `yaml:"debug"`
+		Server       *ServerConfig          `yaml:"server"`
+		Servers      []*ServerConfig        `yaml:"servers"`
+		Metrics      MetricsConfig          `yaml:"metrics"`
+		Http         HttpConfig             `yaml:"http"`
+		Control      ControlConfig          `yaml:"control"`
+		SourceBuffer BufferPoolConfig       `yaml:"source_buffer"`
+		SinkBuffer   BufferConfig           `yaml:"sink_buffer"`
+		Flows        map[string]*FlowConfig `yaml:"flows"`
+		Times        TimeConfig             `yaml:"times"`
+		Misc         MiscConfig             `yaml:"misc"`
+		Console      ConsoleConfig          `yaml:"console"`
+		Webhooks     []WebhookConfig        `yaml:"webhooks"`
+	}{
+		Times:   DefaultTimeConfig,
+		Misc:    DefaultMiscConfig,
+		Console: DefaultConsoleConfig,
 	}
+
 	if err := unmarshal(&aux); err != nil {
 		return err
 	}
 
+	// A single server has no name
+	if aux.Server != nil {
+		if aux.Servers != nil {
+			return errors.New("use either the server or the servers setting, not both")
+		}
+		aux.Servers = []*ServerConfig{aux.Server}
+	} else {
+		names := mapset.NewSet()
+		for _, server := range aux.Servers {
+			if server.Name == "" {
+				return errors.New("servers need a name")
+			}
+			if !names.Add(server.Name) {
+				return errors.Errorf("there is more than one server named %s", server.Name)
+			}
+		}
+	}
+	if len(aux.Servers) == 0 {
+		return errors.New("no server configured")
+	}
+	for _, server := range aux.Servers {
+		if err := server.applyTimes(&aux.Times); err != nil {
+			if server.Name != "" {
+				return errors.Annotatef(err, "invalid times of server %s", server.Name)
+			}
+			return err
+		}
+	}
+
+	for name, flow := range aux.Flows {
+		for _, serverName := range flow.Servers {
+			if !hasServer(aux.Servers, serverName) {
+				return errors.Errorf("flow %s refers to unknown server %s", name, serverName)
+			}
+		}
+
+		flow.Times = aux.Times
+		flow.SourceBuffer = aux.SourceBuffer
+		flow.SinkBuffer = aux.SinkBuffer
+		flow.Misc = aux.Misc
+		flow.Console = aux.Console
+		if err := flow.applyOverrides(); err != nil {
+			return errors.Annotatef(err, "failed to parse settings of flow %s", name)
+		}
+	}
+
 	tc.Debug = aux.Debug
-	tc.Server = aux.Server
+	tc.Servers = aux.Servers
 	tc.Metrics = aux.Metrics
+	tc.Http = aux.Http
+	tc.Control = aux.Control
 	tc.SourceBuffer = aux.SourceBuffer
 	tc.SinkBuffer = aux.SinkBuffer
 	tc.Flows = aux.Flows
 	tc.Times = aux.Times
 	tc.Misc = aux.Misc
+	tc.Console = aux.Console
+	tc.Webhooks = aux.Webhooks
 
 	return nil
 }
 
+func (wc *WebhookConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	aux := struct {
+		Name      string   `yaml:"name"`
+		Url       string   `yaml:"url"`
+		Events    []string `yaml:"events"`
+		Timeout   int      `yaml:"timeout"`
+		QueueSize int      `yaml:"queue_size"`
+	}{
+		Timeout:   5,
+		QueueSize: 100,
+	}
+
+	if err := unmarshal(&aux); err != nil {
+		return errors.Trace(err)
+	}
+
+	if aux.Url == "" {
+		return errors.New("webhooks need a url")
+	}
+	if aux.QueueSize < 1 {
+		return errors.New("queue_size of webhooks must be at least 1")
+	}
+	known := mapset.NewSet()
+	for _, event := range AllEvents {
+		known.Add(event)
+	}
+	for _, event := range aux.Events {
+		if !known.Contains(event) {
+			return errors.Errorf("unknown webhook event: %#v", event)
+		}
+	}
+
+	wc.Name = aux.Name
+	wc.Url = aux.Url
+	wc.Events = aux.Events
+	wc.Timeout = time.Duration(aux.Timeout) * time.Second
+	wc.QueueSize = aux.QueueSize
+	return nil
+}
+
+func (cc *ConsoleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	aux := struct {
+		Type        string `yaml:"type"`
+		LogDir      string `yaml:"log_dir"`
+		LogMaxSize  int64  `yaml:"log_max_size"`
+		LogMaxFiles int    `yaml:"log_max_files"`
+	}{
+		Type:        cc.Type,
+		LogDir:      cc.LogDir,
+		LogMaxSize:  cc.LogMaxSize,
+		LogMaxFiles: cc.LogMaxFiles,
+	}
+
+	if err := unmarshal(&aux); err != nil {
+		return errors.Trace(err)
+	}
+
+	switch aux.Type {
+	case "screen", "tmux", "none":
+	case "logfile":
+		if aux.LogDir == "" {
+			return errors.New("for logfile consoles, the log_dir setting is required")
+		}
+	default:
+		return errors.Errorf("unknown console type: %#v", aux.Type)
+	}
+
+	cc.Type = aux.Type
+	cc.LogDir = aux.LogDir
+	cc.LogMaxSize = aux.LogMaxSize
+	cc.LogMaxFiles = aux.LogMaxFiles
+	return nil
+}
+
 func (mc *MiscConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	aux := struct {
 		ReuseScreens        bool `yaml:"reuse_screens"`
 		RestartWhenSinkDies bool `yaml:"restart_when_sink_dies"`
+		RestartJitter       int  `yaml:"restart_jitter"`
+		GiveUpFailures      int  `yaml:"give_up_failures"`
+		StderrLines         int  `yaml:"stderr_lines"`
+		RestartLoopFailures int  `yaml:"restart_loop_failures"`
+
+		RestartOnMetadataChange []string `yaml:"restart_on_metadata_change"`
 	}{
-		ReuseScreens:        true,
-		RestartWhenSinkDies: false,
+		ReuseScreens:        mc.ReuseScreens,
+		RestartWhenSinkDies: mc.RestartWhenSinkDies,
+		RestartJitter:       mc.RestartJitter,
+		GiveUpFailures:      mc.GiveUpFailures,
+		StderrLines:         mc.StderrLines,
+		RestartLoopFailures: mc.RestartLoopFailures,
+
+		RestartOnMetadataChange: mc.RestartOnMetadataChange,
 	}
 
 	if err := unmarshal(&aux); err != nil {
@@ -124,6 +407,27 @@ func (mc *MiscConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	mc.ReuseScreens = aux.ReuseScreens
 	mc.RestartWhenSinkDies = aux.RestartWhenSinkDies
+	mc.RestartJitter = aux.RestartJitter
+	mc.GiveUpFailures = aux.GiveUpFailures
+	mc.StderrLines = aux.StderrLines
+	mc.RestartLoopFailures = aux.RestartLoopFailures
+	mc.RestartOnMetadataChange = aux.RestartOnMetadataChange
+
+	if mc.RestartJitter < 0 || mc.RestartJitter > 100 {
+		return errors.New("restart_jitter must be between 0 and 100 (percent)")
+	}
+	if mc.StderrLines < 0 {
+		return errors.New("stderr_lines must not be negative")
+	}
+	if mc.RestartLoopFailures < 0 {
+		return errors.New("restart_loop_failures must not be negative")
+	}
+	for _, field := range mc.RestartOnMetadataChange {
+		if !isMetadataField(field) {
+			return errors.Errorf("unknown metadata field %s in restart_on_metadata_change, expected one of %s",
+				field, strings.Join(MetadataFields, ", "))
+		}
+	}
 	return nil
 }
 
@@ -132,18 +436,24 @@ func (tc *TimeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		SourceRestartDelay   int `yaml:"source_restart_delay"`
 		SourceTimeout        int `yaml:"source_timeout"`
 		SinkRestartDelay     int `yaml:"sink_restart_delay"`
+		RestartMaxDelay      int `yaml:"restart_max_delay"`
+		RestartHealthyTime   int `yaml:"restart_healthy_time"`
+		GiveUpWindow         int `yaml:"give_up_window"`
 		ServerPollInterval   int `yaml:"server_poll_interval"`
 		ServerRequestTimeout int `yaml:"server_request_timeout"`
 		ServerTimeout        int `yaml:"server_timeout"`
 		IdleTime             int `yaml:"idle_time"`
 	}{
-		SourceRestartDelay:   3,
-		SourceTimeout:        3,
-		SinkRestartDelay:     3,
-		ServerPollInterval:   5,
-		ServerRequestTimeout: 3,
-		ServerTimeout:        16,
-		IdleTime:             0,
+		SourceRestartDelay:   seconds(tc.SourceRestartDelay),
+		SourceTimeout:        seconds(tc.SourceTimeout),
+		SinkRestartDelay:     seconds(tc.SinkRestartDelay),
+		RestartMaxDelay:      seconds(tc.RestartMaxDelay),
+		RestartHealthyTime:   seconds(tc.RestartHealthyTime),
+		GiveUpWindow:         seconds(tc.GiveUpWindow),
+		ServerPollInterval:   seconds(tc.ServerPollInterval),
+		ServerRequestTimeout: seconds(tc.ServerRequestTimeout),
+		ServerTimeout:        seconds(tc.ServerTimeout),
+		IdleTime:             seconds(tc.IdleTime),
 	}
 
 	if err := unmarshal(&aux); err != nil {
@@ -153,13 +463,64 @@ func (tc *TimeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	tc.SourceRestartDelay = time.Duration(aux.SourceRestartDelay) * time.Second
 	tc.SourceTimeout = time.Duration(aux.SourceTimeout) * time.Second
 	tc.SinkRestartDelay = time.Duration(aux.SinkRestartDelay) * time.Second
+	tc.RestartMaxDelay = time.Duration(aux.RestartMaxDelay) * time.Second
+	tc.RestartHealthyTime = time.Duration(aux.RestartHealthyTime) * time.Second
+	tc.GiveUpWindow = time.Duration(aux.GiveUpWindow) * time.Second
 	tc.ServerPollInterval = time.Duration(aux.ServerPollInterval) * time.Second
 	tc.ServerRequestTimeout = time.Duration(aux.ServerRequestTimeout) * time.Second
 	tc.ServerTimeout = time.Duration(aux.ServerTimeout) * time.Second
 	tc.IdleTime = time.Duration(aux.IdleTime) * time.Second
+
+	// With 0, every failure would reset the backoff: no delays, and never giving up
+	if tc.RestartHealthyTime <= 0 {
+		return errors.New("restart_healthy_time must be at least 1 (second)")
+	}
 	return nil
 }
 
+// applyTimes fills in the timeouts that the server has no own settings for.
+func (sc *ServerConfig) applyTimes(times *TimeConfig) error {
+	sc.PollInterval = times.ServerPollInterval
+	sc.RequestTimeout = times.ServerRequestTimeout
+	sc.Timeout = times.ServerTimeout
+	if sc.pollInterval != nil {
+		sc.PollInterval = time.Duration(*sc.pollInterval) * time.Second
+	}
+	if sc.requestTimeout != nil {
+		sc.RequestTimeout = time.Duration(*sc.requestTimeout) * time.Second
+	}
+	if sc.timeout != nil {
+		sc.Timeout = time.Duration(*sc.timeout) * time.Second
+	}
+
+	if sc.PollInterval <= 0 {
+		return errors.New("poll_interval (or server_poll_interval) must be at least 1 (second)")
+	}
+	return nil
+}
+
+func isMetadataField(name string) bool {
+	for _, field := range MetadataFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasServer(servers []*ServerConfig, name string) bool {
+	for _, server := range servers {
+		if server.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func seconds(d time.Duration) int {
+	return int(d / time.Second)
+}
+
 func (sc *ServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	aux := struct {
 		Url     string   `yaml:"url"`
@@ -167,50 +528,110 @@ func (sc *ServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		XPath   string   `yaml:"xpath"`
 		Type    string   `yaml:"type"`
 		Streams []string `yaml:"streams"`
+		Vhost   string   `yaml:"vhost"`
+
+		SourceTypes []string `yaml:"source_types"`
+
+		MountPrefix  string   `yaml:"mount_prefix"`
+		ContentTypes []string `yaml:"content_types"`
+		NameField    string   `yaml:"name_field"`
+
+		Listen            string `yaml:"listen"`
+		ReconcileInterval int    `yaml:"reconcile_interval"`
+
+		Command string `yaml:"command"`
+		Format  string `yaml:"format"`
+
+		Path string `yaml:"path"`
+
+		Name           string `yaml:"name"`
+		PollInterval   *int   `yaml:"poll_interval"`
+		RequestTimeout *int   `yaml:"request_timeout"`
+		Timeout        *int   `yaml:"timeout"`
 	}{
 		Url:     "",
 		App:     "",
 		Type:    "",
-		XPath:   defaultXpathStrTemplate,
 		Streams: []string{},
+
+		ReconcileInterval: 60,
+		Format:            "lines",
+		NameField:         "mount",
 	}
 
 	if err := unmarshal(&aux); err != nil {
 		return errors.Trace(err)
 	}
-	if (aux.Type == "nginx-rtmp" || aux.Type == "icecast") && aux.Url == "" {
-		return errors.New("for nginx-rtmp or icecast servers, the url setting is required")
+	switch aux.Type {
+	case "nginx-rtmp", "icecast", "srs", "mediamtx":
+		if aux.Url == "" {
+			return errors.Errorf("for %s servers, the url setting is required", aux.Type)
+		}
 	}
-	if aux.Type == "nginx-rtmp" && aux.App == "" {
+	if (aux.Type == "nginx-rtmp" || aux.Type == "nginx-rtmp-push") && aux.App == "" {
 		return errors.New("for nginx-rtmp servers, the app setting is required")
 	}
-	if aux.XPath == "" {
-		return errors.New("xpath setting is required")
+	if aux.Type == "nginx-rtmp-push" && aux.Listen == "" {
+		return errors.New("for nginx-rtmp-push servers, the listen setting is required")
 	}
-
-	// Fill in nginx-rtmp application name in xpath expression.
-	// Proper quoting for XPath is hard, but we don't need it.
-	if strings.ContainsAny(aux.App, "'\"") {
-		return errors.New("app setting must not contain quotes")
+	if aux.Type == "command" {
+		if aux.Command == "" {
+			return errors.New("for command servers, the command setting is required")
+		}
+		command, err := NewCmdData(aux.Command)
+		if err != nil {
+			return errors.Annotate(err, "invalid command")
+		}
+		sc.Command = command
+	}
+	if (aux.Type == "file" || aux.Type == "directory") && aux.Path == "" {
+		return errors.Errorf("for %s servers, the path setting is required", aux.Type)
+	}
+	if aux.NameField != "mount" && aux.NameField != "server_name" {
+		return errors.Errorf("name_field must be mount or server_name, not %#v", aux.NameField)
+	}
+	if aux.Format != "lines" && aux.Format != "json" {
+		return errors.Errorf("format must be lines or json, not %#v", aux.Format)
 	}
-	xpathStr := fmt.Sprintf(aux.XPath, aux.App)
 
-	// Compile XPath expression
-	xpath, err := xmlpath.Compile(xpathStr)
-	if err != nil {
-		return errors.Trace(err)
+	// Without a custom xpath expression, nginx-rtmp servers find the
+	// active streams of the app themselves.
+	sc.XPath = nil
+	if aux.XPath != "" {
+		// Fill in nginx-rtmp application name in xpath expression.
+		// Proper quoting for XPath is hard, but we don't need it.
+		if strings.ContainsAny(aux.App, "'\"") {
+			return errors.New("app setting must not contain quotes")
+		}
+		xpathStr := fmt.Sprintf(aux.XPath, aux.App)
+
+		// Compile XPath expression
+		xpath, err := xmlpath.Compile(xpathStr)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		sc.XPath = xpath
 	}
-	sc.XPath = xpath
 
 	switch aux.Type {
 	case "nginx-rtmp":
 		sc.NewServer = NewNginxRtmp
+	case "nginx-rtmp-push":
+		sc.NewServer = NewNginxRtmpPush
 	case "icecast":
 		sc.NewServer = NewIcecast
+	case "srs":
+		sc.NewServer = NewSrs
+	case "mediamtx":
+		sc.NewServer = NewMediaMtx
+	case "command":
+		sc.NewServer = NewCommandServer
+	case "file", "directory":
+		sc.NewServer = NewWatchServer
 	case "static":
 		sc.NewServer = NewStaticStreamList
 	default:
-		return errors.New("xpath setting is required")
+		return errors.Errorf("unknown server type %#v", aux.Type)
 	}
 
 	sc.Streams = mapset.NewSet()
@@ -218,40 +639,218 @@ func (sc *ServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		sc.Streams.Add(s)
 	}
 
+	sc.Name = aux.Name
+	sc.Type = aux.Type
 	sc.Url = aux.Url
 	sc.App = aux.App
+	sc.Vhost = aux.Vhost
+	sc.SourceTypes = aux.SourceTypes
+	sc.MountPrefix = aux.MountPrefix
+	sc.ContentTypes = aux.ContentTypes
+	sc.NameField = aux.NameField
+	sc.Listen = aux.Listen
+	sc.Format = aux.Format
+	sc.Path = aux.Path
+	sc.ReconcileInterval = time.Duration(aux.ReconcileInterval) * time.Second
+	sc.pollInterval = aux.PollInterval
+	sc.requestTimeout = aux.RequestTimeout
+	sc.timeout = aux.Timeout
 	return nil
 }
 
 func (fc *FlowConfig) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
 	var aux struct {
-		Regexp string            `yaml:"regexp"`
-		Source string            `yaml:"source"`
-		Sinks  map[string]string `yaml:"sinks"`
+		Regexp   string            `yaml:"regexp"`
+		Servers  []string          `yaml:"servers"`
+		Metadata map[string]string `yaml:"metadata"`
+		Source   string            `yaml:"source"`
+		Sinks    map[string]string `yaml:"sinks"`
 	}
 
 	if err := unmarshal(&aux); err != nil {
 		return errors.Trace(err)
 	}
+	if err := unmarshal(&fc.overrides); err != nil {
+		return errors.Trace(err)
+	}
 
 	if fc.Regexp, err = regexp.Compile(aux.Regexp); err != nil {
 		return errors.Annotatef(err, "failed to parse regexp in flow config: %#v", aux.Regexp)
 	}
 
+	fc.Metadata = make(map[string]*regexp.Regexp, len(aux.Metadata))
+	for field, expr := range aux.Metadata {
+		if !isMetadataField(field) {
+			return errors.Errorf("unknown metadata field %s, expected one of %s", field, strings.Join(MetadataFields, ", "))
+		}
+		if fc.Metadata[field], err = regexp.Compile(expr); err != nil {
+			return errors.Annotatef(err, "failed to parse regexp for metadata field %s: %#v", field, expr)
+		}
+	}
+
+	fc.Servers = aux.Servers
+	vars := fc.Variables("", "", "", nil)
+
 	if fc.Source, err = NewCmdData(aux.Source); err != nil {
 		return errors.Annotatef(err, "failed to parse source in flow config: %#v", aux.Source)
 	}
+	if err = fc.Source.Validate(vars); err != nil {
+		return errors.Annotatef(err, "failed to parse source in flow config: %#v", aux.Source)
+	}
 
+	vars["{sink}"] = ""
 	fc.Sinks = make(map[string]CmdData, len(aux.Sinks))
 	for name, command := range aux.Sinks {
-		if fc.Sinks[name], err = NewCmdData(command); err != nil {
+		sink, err := NewCmdData(command)
+		if err == nil {
+			err = sink.Validate(vars)
+		}
+		if err != nil {
 			return errors.Annotatef(err, "failed to parse command for sink %s: %s", name, command)
 		}
+		fc.Sinks[name] = sink
+	}
+
+	return nil
+}
+
+// applyOverrides applies the flows own settings sections on top of
+// the settings it currently has (which are the global ones).
+//
+// Settings that a section leaves out keep their current value.
+func (fc *FlowConfig) applyOverrides() error {
+	sections := []struct {
+		raw    yaml.MapSlice
+		target interface{}
+	}{
+		{fc.overrides.Times, &fc.Times},
+		{fc.overrides.SourceBuffer, &fc.SourceBuffer},
+		{fc.overrides.SinkBuffer, &fc.SinkBuffer},
+		{fc.overrides.Misc, &fc.Misc},
+		{fc.overrides.Console, &fc.Console},
+	}
+
+	for _, section := range sections {
+		if section.raw == nil {
+			continue
+		}
+		bytes, err := yaml.Marshal(section.raw)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := yaml.Unmarshal(bytes, section.target); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
 	return nil
 }
 
+// Matches returns whether the flow wants a stream of a server.
+//
+// Metadata fields that the server didn't provide are matched as empty strings.
+func (fc *FlowConfig) Matches(server string, stream string, metadata Metadata) bool {
+	if len(fc.Servers) > 0 {
+		found := false
+		for _, name := range fc.Servers {
+			found = found || name == server
+		}
+		if !found {
+			return false
+		}
+	}
+	for field, expr := range fc.Metadata {
+		if !expr.MatchString(metadata[field]) {
+			return false
+		}
+	}
+	return fc.Regexp.MatchString(stream)
+}
+
+// Variables returns the variables that can be used in the commands of a flow.
+//
+// Besides the server, stream and flow name and autotee's PID, these are the numbered
+// and named capture groups of the flows regexp, as matched against the stream,
+// and the metadata fields of the stream (empty if unknown).
+// Sink commands can additionally use "{sink}".
+func (fc *FlowConfig) Variables(server string, name string, stream string, metadata Metadata) map[string]string {
+	vars := make(map[string]string)
+
+	for _, field := range MetadataFields {
+		vars["{"+field+"}"] = metadata[field]
+	}
+
+	match := fc.Regexp.FindStringSubmatch(stream)
+	for i, group := range fc.Regexp.SubexpNames() {
+		value := ""
+		if i < len(match) {
+			value = match[i]
+		}
+		vars[fmt.Sprintf("{%d}", i)] = value
+		if group != "" {
+			vars["{"+group+"}"] = value
+		}
+	}
+
+	vars["{server}"] = server
+	vars["{stream}"] = stream
+	vars["{flow}"] = name
+	vars["{pid}"] = strconv.Itoa(os.Getpid())
+	return vars
+}
+
+// Commands returns the source and sink commands of a flow, with the variables
+// substituted. In sink commands, "{sink}" is the name of the sink.
+func (fc *FlowConfig) Commands(vars map[string]string) (CmdData, map[string]CmdData) {
+	source := fc.Source.Replace(vars)
+	sinks := make(map[string]CmdData, len(fc.Sinks))
+	for sinkName, sinkTemplate := range fc.Sinks {
+		sinkVars := make(map[string]string, len(vars)+1)
+		for k, v := range vars {
+			sinkVars[k] = v
+		}
+		sinkVars["{sink}"] = sinkName
+		sinks[sinkName] = sinkTemplate.Replace(sinkVars)
+	}
+	return source, sinks
+}
+
+// Equals reports whether two flow configurations would behave the same.
+func (fc *FlowConfig) Equals(other *FlowConfig) bool {
+	if fc.Regexp.String() != other.Regexp.String() {
+		return false
+	}
+	if strings.Join(fc.Servers, ",") != strings.Join(other.Servers, ",") {
+		return false
+	}
+	if len(fc.Metadata) != len(other.Metadata) {
+		return false
+	}
+	for field, expr := range fc.Metadata {
+		otherExpr, ok := other.Metadata[field]
+		if !ok || expr.String() != otherExpr.String() {
+			return false
+		}
+	}
+	if !fc.Source.Equals(other.Source) {
+		return false
+	}
+	if len(fc.Sinks) != len(other.Sinks) {
+		return false
+	}
+	for name, sink := range fc.Sinks {
+		otherSink, ok := other.Sinks[name]
+		if !ok || !sink.Equals(otherSink) {
+			return false
+		}
+	}
+	return fc.Times.flowTimes() == other.Times.flowTimes() &&
+		fc.SourceBuffer == other.SourceBuffer &&
+		fc.SinkBuffer == other.SinkBuffer &&
+		reflect.DeepEqual(fc.Misc, other.Misc) &&
+		fc.Console == other.Console
+}
+
 func LoadConfig(path string) (*Config, error) {
 	var config Config
 
@@ -0,0 +1,348 @@
+package autotee
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const overrideTestConfig = `
+server:
+  type: "static"
+times:
+  source_timeout: 5
+  sink_restart_delay: 7
+source_buffer:
+  buffer_count: 64
+  buffer_size: 1024
+sink_buffer:
+  buffer_count: 24
+flows:
+  "plain":
+    regexp: "^a$"
+    source: "source"
+  "custom":
+    regexp: "^b$"
+    source: "source"
+    times:
+      source_timeout: 0
+    source_buffer:
+      buffer_size: 2048
+    misc:
+      restart_when_sink_dies: true
+`
+
+func TestFlowConfigOverrides(t *testing.T) {
+	var config Config
+	if err := yaml.Unmarshal([]byte(overrideTestConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := config.Flows["plain"]
+	if plain.Times != config.Times {
+		t.Fatalf("Flow without overrides has times %+v, expected %+v", plain.Times, config.Times)
+	}
+	if !reflect.DeepEqual(plain.Misc, config.Misc) {
+		t.Fatalf("Flow without overrides has misc %+v, expected %+v", plain.Misc, config.Misc)
+	}
+
+	custom := config.Flows["custom"]
+	if custom.Times.SourceTimeout != 0 {
+		t.Fatalf("Overridden source timeout was %v, expected 0", custom.Times.SourceTimeout)
+	}
+	if custom.Times.SinkRestartDelay != 7*time.Second {
+		t.Fatalf("Inherited sink restart delay was %v, expected 7s", custom.Times.SinkRestartDelay)
+	}
+	if custom.Times.ServerTimeout != DefaultTimeConfig.ServerTimeout {
+		t.Fatalf("Default server timeout was %v, expected %v", custom.Times.ServerTimeout, DefaultTimeConfig.ServerTimeout)
+	}
+	if custom.SourceBuffer.BufferSize != 2048 || custom.SourceBuffer.BufferCount != 64 {
+		t.Fatalf("Source buffer was %+v, expected 64 buffers of 2048 bytes", custom.SourceBuffer)
+	}
+	if custom.SinkBuffer != config.SinkBuffer {
+		t.Fatalf("Sink buffer was %+v, expected %+v", custom.SinkBuffer, config.SinkBuffer)
+	}
+	if !custom.Misc.RestartWhenSinkDies || !custom.Misc.ReuseScreens {
+		t.Fatalf("Misc was %+v, expected both settings enabled", custom.Misc)
+	}
+
+	if plain.Equals(custom) {
+		t.Fatal("Flows with different settings should not be equal")
+	}
+}
+
+func TestFlowConfigUnknownPlaceholder(t *testing.T) {
+	var flow FlowConfig
+
+	err := yaml.Unmarshal([]byte(`{regexp: "^(?P<room>s\\d+)$", source: "src {room}", sinks: {a: "dst {rooom}"}}`), &flow)
+	if err == nil {
+		t.Fatal("Unknown placeholder should have been rejected")
+	}
+
+	err = yaml.Unmarshal([]byte(`{regexp: "^(?P<room>s\\d+)$", source: "src {room}", sinks: {a: "dst {sink}/{1}"}}`), &flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const serversTestConfig = `
+servers:
+  - name: "main"
+    type: "static"
+  - name: "backup"
+    type: "static"
+    poll_interval: 30
+times:
+  server_poll_interval: 2
+flows:
+  "main":
+    regexp: ".*"
+    servers: ["main"]
+    source: "source {server}/{stream}"
+  "any":
+    regexp: "^s\\d+$"
+    source: "source {server}/{stream}"
+`
+
+func TestServersConfig(t *testing.T) {
+	var config Config
+	if err := yaml.Unmarshal([]byte(serversTestConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(config.Servers))
+	}
+	if config.Servers[0].PollInterval != 2*time.Second {
+		t.Fatalf("Inherited poll interval was %v, expected 2s", config.Servers[0].PollInterval)
+	}
+	if config.Servers[1].PollInterval != 30*time.Second {
+		t.Fatalf("Own poll interval was %v, expected 30s", config.Servers[1].PollInterval)
+	}
+
+	tests := []struct {
+		flow, server, stream string
+		expected             bool
+	}{
+		{"main", "main", "x", true},
+		{"main", "backup", "x", false},
+		{"any", "backup", "s1", true},
+		{"any", "main", "x", false},
+	}
+	for _, test := range tests {
+		if matches := config.Flows[test.flow].Matches(test.server, test.stream, nil); matches != test.expected {
+			t.Errorf("Flow %s matching %s/%s was %v, expected %v", test.flow, test.server, test.stream, matches, test.expected)
+		}
+	}
+}
+
+func TestServersConfigInvalid(t *testing.T) {
+	configs := []string{
+		// Neither server nor servers
+		`flows: {}`,
+		// Both server and servers
+		`{server: {type: static}, servers: [{name: a, type: static}]}`,
+		// Unnamed
+		`{servers: [{type: static}]}`,
+		// Same name twice
+		`{servers: [{name: a, type: static}, {name: a, type: static}]}`,
+		// Unknown server in flow
+		`{servers: [{name: a, type: static}], flows: {f: {regexp: ".*", source: "x", servers: [b]}}}`,
+		// Backoff that never backs off
+		`{server: {type: static}, times: {restart_healthy_time: 0}}`,
+		`{server: {type: static}, flows: {f: {regexp: ".*", source: "x", times: {restart_healthy_time: 0}}}}`,
+		// Never polling
+		`{server: {type: static}, times: {server_poll_interval: 0}}`,
+		`{server: {type: static, poll_interval: 0}}`,
+		`{servers: [{name: a, type: static}, {name: b, type: static, poll_interval: -1}]}`,
+	}
+	for _, text := range configs {
+		var config Config
+		if err := yaml.Unmarshal([]byte(text), &config); err == nil {
+			t.Errorf("Config %s should have been rejected", text)
+		}
+	}
+}
+
+func TestFlowConfigMetadata(t *testing.T) {
+	var flow FlowConfig
+	err := yaml.Unmarshal([]byte(`{regexp: "^s\\d+", metadata: {height: "^1080$"}, source: "src {stream} {width}x{height} {vcodec}"}`), &flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hd := Metadata{"width": "1920", "height": "1080", "vcodec": "H264"}
+	if !flow.Matches("", "s1", hd) {
+		t.Error("Flow should match 1080p stream")
+	}
+	if flow.Matches("", "s1", Metadata{"height": "576"}) || flow.Matches("", "s1", nil) {
+		t.Error("Flow should only match 1080p streams")
+	}
+
+	source := flow.Source.Replace(flow.Variables("", "video", "s1", hd))
+	if expected := []string{"s1", "1920x1080", "H264"}; !reflect.DeepEqual(source.Args, expected) {
+		t.Errorf("Source arguments were %#v, expected %#v", source.Args, expected)
+	}
+
+	err = yaml.Unmarshal([]byte(`{regexp: ".*", metadata: {resolution: "1080"}, source: "src"}`), &flow)
+	if err == nil {
+		t.Error("Unknown metadata field should have been rejected")
+	}
+}
+
+func TestRestartOnMetadataChange(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+server: {type: static}
+misc: {restart_on_metadata_change: [width, height]}
+flows:
+  "plain": {regexp: ".*", source: "src"}
+  "custom": {regexp: ".*", source: "src", misc: {restart_on_metadata_change: [vcodec]}}
+`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := Metadata{"width": "1920", "height": "1080", "vcodec": "H264", "bw_in": "100"}
+	cur := Metadata{"width": "1280", "height": "720", "vcodec": "H264", "bw_in": "200"}
+	if changed := prev.Diff(cur, config.Flows["plain"].Misc.RestartOnMetadataChange); !reflect.DeepEqual(changed, []string{"width", "height"}) {
+		t.Errorf("Changed fields were %#v, expected width and height", changed)
+	}
+	if changed := prev.Diff(cur, config.Flows["custom"].Misc.RestartOnMetadataChange); len(changed) != 0 {
+		t.Errorf("Changed fields were %#v, expected none", changed)
+	}
+	if changed := prev.Diff(Metadata{"width": "1920"}, config.Flows["plain"].Misc.RestartOnMetadataChange); len(changed) != 0 {
+		t.Errorf("Changed fields were %#v, expected none (height unknown)", changed)
+	}
+	if config.Flows["plain"].Equals(config.Flows["custom"]) {
+		t.Error("Flows tracking different fields should not be equal")
+	}
+
+	err = yaml.Unmarshal([]byte(`{server: {type: static}, misc: {restart_on_metadata_change: [resolution]}}`), &config)
+	if err == nil {
+		t.Error("Unknown metadata field should have been rejected")
+	}
+}
+
+func TestFlowConfigEquals(t *testing.T) {
+	const flow = `
+flows:
+  "f":
+    regexp: "^a$"
+    source: "source"
+    sinks: {a: "sink"}
+    times:
+      sink_restart_delay: 8
+    misc:
+      restart_jitter: 10
+`
+	const server = "server: {type: \"static\"}\n"
+	const base = "times: {source_timeout: 5}\n"
+
+	tests := []struct {
+		name     string
+		text     string
+		expected bool
+	}{
+		{"same", base + flow, true},
+		{"global setting changed", "times: {source_timeout: 6}\n" + flow, false},
+		{"overridden global setting changed", "times: {source_timeout: 5, sink_restart_delay: 9}\n" + flow, true},
+		{"global misc overridden", base + "misc: {restart_jitter: 20}\n" + flow, true},
+		{"global setting only used at startup", "times: {source_timeout: 5, idle_time: 60, server_poll_interval: 1}\n" + flow, true},
+		{"override changed", base + strings.Replace(flow, "sink_restart_delay: 8", "sink_restart_delay: 4", 1), false},
+		{"override added", base + strings.Replace(flow, "restart_jitter: 10", "restart_jitter: 10\n      give_up_failures: 2", 1), false},
+		{"override removed", base + strings.Replace(flow, "    times:\n      sink_restart_delay: 8\n", "", 1), false},
+		{"source changed", base + strings.Replace(flow, `source: "source"`, `source: "other"`, 1), false},
+		{"sink changed", base + strings.Replace(flow, `{a: "sink"}`, `{a: "other"}`, 1), false},
+		{"sink renamed", base + strings.Replace(flow, `{a: "sink"}`, `{b: "sink"}`, 1), false},
+		{"regexp changed", base + strings.Replace(flow, `"^a$"`, `"^b$"`, 1), false},
+	}
+
+	var original Config
+	if err := yaml.Unmarshal([]byte(server+base+flow), &original); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		var config Config
+		if err := yaml.Unmarshal([]byte(server+test.text), &config); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if equal := original.Flows["f"].Equals(config.Flows["f"]); equal != test.expected {
+			t.Errorf("%s: Equals was %v, expected %v", test.name, equal, test.expected)
+		}
+	}
+}
+
+func TestFlowConfigVariables(t *testing.T) {
+	var flow FlowConfig
+	err := yaml.Unmarshal([]byte(`{regexp: "^(?P<stream>s(\\d+))_(?P<lang>native|translated)(_hd)?$", source: "source"}`), &flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := Metadata{"height": "1080"}
+
+	tests := []struct {
+		stream   string
+		expected map[string]string
+	}{
+		{"s1_native_hd", map[string]string{
+			"{0}": "s1_native_hd", "{1}": "s1", "{2}": "1", "{3}": "native", "{4}": "_hd",
+			"{lang}": "native",
+		}},
+		// Unmatched optional group
+		{"s2_translated", map[string]string{
+			"{0}": "s2_translated", "{1}": "s2", "{2}": "2", "{3}": "translated", "{4}": "",
+			"{lang}": "translated",
+		}},
+		{"other", map[string]string{
+			"{0}": "", "{1}": "", "{2}": "", "{3}": "", "{4}": "",
+			"{lang}": "",
+		}},
+	}
+
+	for _, test := range tests {
+		vars := flow.Variables("main", "f", test.stream, metadata)
+
+		// Built-in variables win over capture groups of the same name
+		test.expected["{stream}"] = test.stream
+		test.expected["{server}"] = "main"
+		test.expected["{flow}"] = "f"
+		test.expected["{pid}"] = strconv.Itoa(os.Getpid())
+		test.expected["{height}"] = "1080"
+		test.expected["{width}"] = ""
+
+		for key, value := range test.expected {
+			if actual, ok := vars[key]; !ok || actual != value {
+				t.Errorf("%s: %s was %#v, expected %#v", test.stream, key, actual, value)
+			}
+		}
+		if _, ok := vars["{5}"]; ok {
+			t.Errorf("%s: {5} should not be defined", test.stream)
+		}
+	}
+}
+
+func TestFlowConfigCommands(t *testing.T) {
+	var flow FlowConfig
+	err := yaml.Unmarshal([]byte(`{regexp: "^(s\\d+)$", source: "src {stream}", sinks: {rec: "dst {1}/{sink}.ts", "push": "dst {flow}-{sink}"}}`), &flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, sinks := flow.Commands(flow.Variables("", "f", "s1", nil))
+	if expected := (CmdData{"src", []string{"s1"}}); !source.Equals(expected) {
+		t.Errorf("Source was %s, expected %s", source.String(), expected.String())
+	}
+	expected := map[string]CmdData{
+		"rec":  {"dst", []string{"s1/rec.ts"}},
+		"push": {"dst", []string{"f-push"}},
+	}
+	if !reflect.DeepEqual(sinks, expected) {
+		t.Errorf("Sinks were %#v, expected %#v", sinks, expected)
+	}
+}
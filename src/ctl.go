@@ -0,0 +1,176 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/juju/errors"
+)
+
+// ControlClient talks to a running instance via its control socket.
+type ControlClient struct {
+	client http.Client
+}
+
+func NewControlClient(socket string) *ControlClient {
+	return &ControlClient{
+		client: http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Get fetches a document from the running instance.
+func (cc *ControlClient) Get(path string) ([]byte, error) {
+	return cc.do(cc.client.Get("http://autotee" + path))
+}
+
+// Post sends a command to the running instance.
+func (cc *ControlClient) Post(path string, params url.Values) ([]byte, error) {
+	return cc.do(cc.client.PostForm("http://autotee"+path, params))
+}
+
+func (cc *ControlClient) do(resp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, errors.Annotate(err, "failed to connect to control socket")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// ctlServerFlag selects the server of a stream, if there are several.
+var ctlServerFlag = cli.StringFlag{
+	Name:  "server",
+	Usage: "Name of the server the stream is on",
+}
+
+// CtlCommands are the subcommands that talk to a running instance.
+func CtlCommands() []cli.Command {
+	return []cli.Command{
+		{
+			Name:   "status",
+			Usage:  "Show flows and processes of a running instance",
+			Action: ctlGetAction("/status"),
+		},
+		{
+			Name:   "streams",
+			Usage:  "Show active streams of a running instance",
+			Action: ctlGetAction("/streams"),
+		},
+		{
+			Name:      "stderr",
+			Usage:     "Show recent stderr output of a flows source, or of one of its sinks",
+			ArgsUsage: "stream flow [sink]",
+			Flags:     []cli.Flag{ctlServerFlag},
+			Action:    ctlGetAction("/stderr", "stream", "flow", "[sink]"),
+		},
+		{
+			Name:   "reload",
+			Usage:  "Make a running instance reload its configuration",
+			Action: ctlPostAction("/control/reload"),
+		},
+		{
+			Name:      "restart",
+			Usage:     "Restart a flow, or one of its sinks",
+			ArgsUsage: "stream flow [sink]",
+			Flags:     []cli.Flag{ctlServerFlag},
+			Action:    ctlPostAction("/control/restart", "stream", "flow", "[sink]"),
+		},
+		{
+			Name:      "disable",
+			Usage:     "Stop a flow or one of its sinks until it is enabled",
+			ArgsUsage: "stream flow [sink]",
+			Flags:     []cli.Flag{ctlServerFlag},
+			Action:    ctlPostAction("/control/disable", "stream", "flow", "[sink]"),
+		},
+		{
+			Name:      "enable",
+			Usage:     "Allow a disabled or given up flow or sink to run again",
+			ArgsUsage: "stream flow [sink]",
+			Flags:     []cli.Flag{ctlServerFlag},
+			Action:    ctlPostAction("/control/enable", "stream", "flow", "[sink]"),
+		},
+	}
+}
+
+// ctlGetAction returns an action that fetches a document, sending its
+// arguments as the given query parameters. Parameter names in brackets are optional.
+func ctlGetAction(path string, paramNames ...string) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		params := ctlParams(c, paramNames)
+
+		query := path
+		if len(params) != 0 {
+			query += "?" + params.Encode()
+		}
+		body, err := NewControlClient(c.GlobalString("socket")).Get(query)
+		if err != nil {
+			return err
+		}
+
+		os.Stdout.Write(body)
+		if !strings.HasSuffix(string(body), "\n") {
+			os.Stdout.WriteString("\n")
+		}
+		return nil
+	}
+}
+
+// ctlPostAction returns an action that sends its arguments as the given
+// parameters. Parameter names in brackets are optional.
+func ctlPostAction(path string, paramNames ...string) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		params := ctlParams(c, paramNames)
+
+		body, err := NewControlClient(c.GlobalString("socket")).Post(path, params)
+		if err != nil {
+			return err
+		}
+
+		os.Stdout.Write(body)
+		os.Stdout.WriteString("\n")
+		return nil
+	}
+}
+
+// ctlParams maps the arguments of a command to parameters.
+// Shows the usage and exits if there are too few or too many.
+func ctlParams(c *cli.Context, paramNames []string) url.Values {
+	required := 0
+	for _, name := range paramNames {
+		if !strings.HasPrefix(name, "[") {
+			required++
+		}
+	}
+	if len(c.Args()) < required || len(c.Args()) > len(paramNames) {
+		cli.ShowCommandHelp(c, c.Command.Name)
+		os.Exit(1)
+	}
+
+	params := url.Values{}
+	for i, arg := range c.Args() {
+		params.Set(strings.Trim(paramNames[i], "[]"), arg)
+	}
+	if server := c.String("server"); server != "" {
+		params.Set("server", server)
+	}
+	return params
+}
@@ -1,12 +1,11 @@
 package autotee
 
 import (
-	"fmt"
-	"os"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
 	"golang.org/x/net/context"
 )
 
@@ -14,13 +13,24 @@ type Flow struct {
 	ctx context.Context
 
 	log    *log.Entry
-	config *Config
+	config *FlowConfig
 	name   string
+	server string
 	stream string
+	labels MetricLabels
+
+	// Metadata of the stream when the flow was started, plus the
+	// fields that became known later. Only used by App.Run.
+	metadata Metadata
 
 	sourceCmd CmdData
 	sinkCmds  map[string]CmdData
 
+	sourceState *ProcessState
+	sinkStates  map[string]*ProcessState
+
+	hooks *Webhooks
+
 	cancel   context.CancelFunc
 	quitWait sync.WaitGroup
 }
@@ -31,20 +41,44 @@ type FlowCmdData struct {
 	screens ScreenService
 }
 
-func NewFlow(ctx context.Context, name string, stream string, config *Config, sourceCmd CmdData, sinkCmds map[string]CmdData, entry *log.Entry) *Flow {
+func NewFlow(ctx context.Context, name string, stream StreamId, metadata Metadata, config *FlowConfig, sourceCmd CmdData, sinkCmds map[string]CmdData, entry *log.Entry, hooks *Webhooks) *Flow {
 	flowCtx, cancel := context.WithCancel(ctx)
 
+	labels := MetricLabels{"flow": name, "stream": stream.Stream}
+	if stream.Server != "" {
+		labels["server"] = stream.Server
+	}
+
+	ownMetadata := make(Metadata, len(metadata))
+	for field, value := range metadata {
+		ownMetadata[field] = value
+	}
+
+	sinkStates := make(map[string]*ProcessState, len(sinkCmds))
+	for name := range sinkCmds {
+		sinkStates[name] = NewProcessState(config.Misc.StderrLines)
+	}
+
 	return &Flow{
 		ctx: flowCtx,
 
 		log:    entry,
 		config: config,
 		name:   name,
-		stream: stream,
+		server: stream.Server,
+		stream: stream.Stream,
+		labels: labels,
+
+		metadata: ownMetadata,
 
 		sourceCmd: sourceCmd,
 		sinkCmds:  sinkCmds,
 
+		sourceState: NewProcessState(config.Misc.StderrLines),
+		sinkStates:  sinkStates,
+
+		hooks: hooks,
+
 		cancel: cancel,
 	}
 }
@@ -63,42 +97,84 @@ func (f *Flow) Stop() {
 	f.quitWait.Wait()
 }
 
+// Source returns the state of the flows source.
+//
+// Restarting or disabling the source restarts or disables the whole flow.
+func (f *Flow) Source() *ProcessState {
+	return f.sourceState
+}
+
+// Sink returns the state of one of the flows sinks, or nil if there's no such sink.
+func (f *Flow) Sink(name string) *ProcessState {
+	return f.sinkStates[name]
+}
+
+// Status describes the flow and its processes.
+//
+// Thread-safe.
+func (f *Flow) Status() FlowStatus {
+	status := FlowStatus{
+		Server: f.server,
+		Stream: f.stream,
+		Flow:   f.name,
+		Source: f.sourceState.Status(),
+		Sinks:  make(map[string]ProcessStatus, len(f.sinkStates)),
+	}
+	for name, state := range f.sinkStates {
+		status.Sinks[name] = state.Status()
+	}
+	return status
+}
+
 func (f *Flow) goRun() {
 	f.quitWait.Add(1)
 	go func() {
 		defer f.quitWait.Done()
+		defer UnregisterMetrics(metrics.DefaultRegistry, f.labels)
 
 		var bufpool *BufPool
 
-		sourceScreenName := fmt.Sprintf("autotee:%d:%s:%s", os.Getpid(), f.stream, f.name)
-		var sourceScreens ScreenService
-		if f.config.Misc.ReuseScreens {
-			sourceScreens = NewSharedScreenService(sourceScreenName)
-		} else {
-			sourceScreens = NewExclusiveScreenService(sourceScreenName)
-		}
+		backoff := NewBackoff(f.config.Times.SourceRestartDelay, &f.config.Times, &f.config.Misc)
+		gaveUpMetric := metrics.GetOrRegister(f.labels.Name("source.given_up"), metrics.NewGauge()).(metrics.Gauge)
+
+		sourceId := ProcessId{f.server, f.stream, f.name, ""}
+		sourceHooks := f.hooks.For(sourceId)
+		sourceScreens := f.config.Console.NewScreenService(sourceId, f.config.Misc.ReuseScreens)
 		defer sourceScreens.Stop()
 
 		sinkCmds := make(map[string]SinkCmdData, len(f.sinkCmds))
 		for name, sinkCmd := range f.sinkCmds {
-
-			var sinkScreens ScreenService
-			sinkScreenName := fmt.Sprintf("autotee:%d:%s:%s:%s", os.Getpid(), f.stream, f.name, name)
-			if f.config.Misc.ReuseScreens {
-				sinkScreens = NewSharedScreenService(sinkScreenName)
-			} else {
-				sinkScreens = NewExclusiveScreenService(sinkScreenName)
-			}
+			sinkId := ProcessId{f.server, f.stream, f.name, name}
+			sinkScreens := f.config.Console.NewScreenService(sinkId, f.config.Misc.ReuseScreens)
 			defer sinkScreens.Stop()
 
 			sinkCmds[name] = SinkCmdData{
 				Screens: sinkScreens,
 				Command: sinkCmd,
+				State:   f.sinkStates[name],
+				Backoff: NewBackoff(f.config.Times.SinkRestartDelay, &f.config.Times, &f.config.Misc),
+				Hooks:   f.hooks.For(sinkId),
 			}
 		}
 
+		gaveUp := func() {
+			f.log.WithField("failures", f.config.Misc.GiveUpFailures).Error("Source keeps failing, giving up")
+			gaveUpMetric.Update(1)
+		}
+
+		// Waits before the next attempt. Returns false if the flow is stopping.
+		waitBeforeRestart := func(uptime time.Duration, killed bool) bool {
+			return backoff.WaitBeforeRestart(f.ctx, uptime, killed, f.sourceState, sourceHooks, gaveUp)
+		}
+
 		for {
 
+			// Disabled at runtime, or given up?
+			if !f.sourceState.WaitEnabled(f.ctx) {
+				return
+			}
+			gaveUpMetric.Update(0)
+
 			if bufpool != nil && !bufpool.IsFull() {
 				f.log.Warn("Bug: not all buffers were freed; not reusing pool")
 				bufpool = nil
@@ -107,43 +183,43 @@ func (f *Flow) goRun() {
 				bufpool = NewBufPool(f.config.SourceBuffer.BufferCount, f.config.SourceBuffer.BufferSize)
 			}
 
-			// Get a screen for the new process
+			// Get a screen for the new process (nil in headless mode)
 			screen, err := sourceScreens.Screen()
 			if err != nil {
 				f.log.WithError(err).Warn("Failed to start screen")
 
 				// Wait before trying again
-				select {
-				case <-time.After(f.config.Times.SourceRestartDelay):
+				if waitBeforeRestart(0, false) {
 					continue
-				case <-f.ctx.Done():
-					return
 				}
+				return
 			}
 
 			// Try to start process
-			source := NewSource(f.ctx, f.name, f.sourceCmd, f.config, f.log, bufpool, screen)
+			source := NewSource(f.ctx, f.labels, f.sourceCmd, f.config, f.log, bufpool, screen, f.sourceState.Stderr(), sourceHooks)
 			channel := source.Channel()
 			if f.config.Times.SourceTimeout > 0 {
 				channel = WatchChannel(channel, f.config.Times.SourceTimeout, source.Kill)
 			}
-			sinks := NewSinkSet(f.ctx, sinkCmds, channel, f.config, f.log)
+			sinks := NewSinkSet(f.ctx, sinkCmds, channel, f.config, f.log, f.labels)
 			sinks.Start()
 
 			// Failure?
 			if err := source.Start(); err != nil {
+				f.sourceState.Exited(err)
 				sinks.Stop()
 				sourceScreens.Done()
 
 				// Wait before trying again
-				select {
-				case <-time.After(f.config.Times.SourceRestartDelay):
+				if waitBeforeRestart(0, false) {
 					continue
-				case <-f.ctx.Done():
-					return
 				}
+				return
 			}
 
+			f.sourceState.Started(source, screen.GetName())
+			started := time.Now()
+
 			var anySinkDied <-chan struct{}
 			if f.config.Misc.RestartWhenSinkDies {
 				anySinkDied = sinks.AnySinkDied()
@@ -160,6 +236,9 @@ func (f *Flow) goRun() {
 
 			// Wait till its really dead
 			source.Stop()
+			uptime := time.Since(started)
+			killed := f.sourceState.Killed()
+			f.sourceState.Exited(source.ExitError())
 
 			sinks.Stop()
 
@@ -180,10 +259,7 @@ func (f *Flow) goRun() {
 			screensStopped.Wait()
 
 			// Wait before respawning
-			select {
-			case <-time.After(f.config.Times.SourceRestartDelay):
-				continue
-			case <-f.ctx.Done():
+			if !waitBeforeRestart(uptime, killed) {
 				return
 			}
 		}
@@ -0,0 +1,233 @@
+package autotee
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+// startHttp starts the built-in HTTP server and the control socket,
+// if they are configured.
+//
+// They run until the app is stopped.
+// Does not block.
+func (app *App) startHttp() error {
+	if listen := app.Config.Http.Listen; listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return errors.Annotatef(err, "failed to listen on %s", listen)
+		}
+		app.serveHttp(listener, app.httpHandler())
+		log.WithField("listen", listen).Info("HTTP server started")
+	}
+
+	if socket := app.Config.Control.Socket; socket != "" {
+		listener, err := listenControlSocket(socket)
+		if err != nil {
+			return err
+		}
+		app.serveHttp(listener, app.controlHandler())
+		log.WithField("socket", socket).Info("Control socket started")
+	}
+
+	return nil
+}
+
+// listenControlSocket listens on a unix socket.
+//
+// A socket left over by a previous instance is replaced. A socket that is
+// still in use (by another instance) or any other kind of file is not.
+func listenControlSocket(socket string) (net.Listener, error) {
+	info, err := os.Lstat(socket)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("control socket %s already exists and is not a socket", socket)
+		}
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("control socket %s is already in use", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, errors.Annotatef(err, "failed to remove old control socket %s", socket)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Annotatef(err, "failed to check control socket %s", socket)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to listen on %s", socket)
+	}
+	return listener, nil
+}
+
+// serveHttp serves HTTP requests from a listener until the app is stopped.
+//
+// Does not block.
+func (app *App) serveHttp(listener net.Listener, handler http.Handler) {
+	go func() {
+		<-app.ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		err := http.Serve(listener, handler)
+		if app.ctx.Err() == nil {
+			log.WithError(err).Error("HTTP server failed")
+		}
+	}()
+}
+
+func (app *App) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	app.addHttpHandlers(mux)
+	return mux
+}
+
+// controlHandler serves everything the HTTP server does, plus the
+// commands that change state. It is only reachable via the control socket.
+func (app *App) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	app.addHttpHandlers(mux)
+	mux.HandleFunc("/control/reload", app.handleReload)
+	mux.HandleFunc("/control/restart", app.handleRestart)
+	mux.HandleFunc("/control/disable", app.handleDisable)
+	mux.HandleFunc("/control/enable", app.handleEnable)
+	return mux
+}
+
+func (app *App) addHttpHandlers(mux *http.ServeMux) {
+	mux.Handle("/metrics", PrometheusHandler(metrics.DefaultRegistry))
+	mux.HandleFunc("/status", app.handleStatus)
+	mux.HandleFunc("/streams", app.handleStreams)
+	mux.HandleFunc("/stderr", app.handleStderr)
+}
+
+func (app *App) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, struct {
+		Version string       `json:"version"`
+		Flows   []FlowStatus `json:"flows"`
+	}{
+		Version,
+		app.Status(),
+	})
+}
+
+func (app *App) handleStreams(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, app.Streams())
+}
+
+// handleStderr shows the recent stderr output of a sink,
+// or of the flows source if no sink is given.
+func (app *App) handleStderr(w http.ResponseWriter, r *http.Request) {
+	_, process, _, ok := app.findTarget(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range process.Stderr().Lines() {
+		io.WriteString(w, line+"\n")
+	}
+}
+
+func (app *App) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := app.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, struct{}{})
+}
+
+// handleRestart restarts a sink, or the whole flow if no sink is given.
+func (app *App) handleRestart(w http.ResponseWriter, r *http.Request) {
+	flow, process, entry, ok := app.controlTarget(w, r)
+	if !ok {
+		return
+	}
+
+	entry.Info("Restarting on request")
+	process.Restart()
+	writeJson(w, flow.Status())
+}
+
+// handleDisable stops a sink, or the whole flow if no sink is given,
+// until it is enabled again.
+func (app *App) handleDisable(w http.ResponseWriter, r *http.Request) {
+	flow, process, entry, ok := app.controlTarget(w, r)
+	if !ok {
+		return
+	}
+
+	entry.Info("Disabling on request")
+	process.Disable()
+	writeJson(w, flow.Status())
+}
+
+func (app *App) handleEnable(w http.ResponseWriter, r *http.Request) {
+	flow, process, entry, ok := app.controlTarget(w, r)
+	if !ok {
+		return
+	}
+
+	entry.Info("Enabling on request")
+	process.Enable()
+	writeJson(w, flow.Status())
+}
+
+// controlTarget looks up the flow and sink named by the "stream", "flow"
+// and "sink" parameters of a control request. Without a sink parameter,
+// the process is the flows source, which controls the whole flow.
+//
+// If that fails, an error has been sent and ok is false.
+func (app *App) controlTarget(w http.ResponseWriter, r *http.Request) (flow *Flow, process *ProcessState, entry *log.Entry, ok bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, nil, nil, false
+	}
+
+	return app.findTarget(w, r)
+}
+
+// findTarget is like controlTarget, but allows any method.
+func (app *App) findTarget(w http.ResponseWriter, r *http.Request) (flow *Flow, process *ProcessState, entry *log.Entry, ok bool) {
+	flow = app.FindFlow(StreamId{r.FormValue("server"), r.FormValue("stream")}, r.FormValue("flow"))
+	if flow == nil {
+		http.Error(w, "No such flow", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+
+	sinkName := r.FormValue("sink")
+	if sinkName == "" {
+		return flow, flow.Source(), flow.log, true
+	}
+
+	process = flow.Sink(sinkName)
+	if process == nil {
+		http.Error(w, "No such sink", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	return flow, process, flow.log.WithField("sink", sinkName), true
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
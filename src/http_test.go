@@ -0,0 +1,48 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenControlSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autotee-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "autotee.sock")
+
+	// Socket in use by another instance
+	listener, err := listenControlSocket(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenControlSocket(socket); err == nil {
+		t.Fatal("Socket in use should not have been replaced")
+	}
+
+	// Stale socket of an instance that died
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	listener, err = listenControlSocket(socket)
+	if err != nil {
+		t.Fatalf("Stale socket should have been replaced: %s", err)
+	}
+	listener.Close()
+
+	// Any other file
+	other := filepath.Join(dir, "other")
+	if err := ioutil.WriteFile(other, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenControlSocket(other); err == nil {
+		t.Fatal("Regular file should not have been replaced")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,6 +3,8 @@ package autotee
 import (
 	"encoding/json"
 	"os"
+	"sort"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -20,13 +22,28 @@ func Main() {
 	parser.Name = "autotee"
 	parser.Usage = "yada yada"
 	parser.ArgsUsage = "config.yml"
+	parser.Description = "Without a command, autotee runs with the given configuration file."
 	parser.HideHelp = true
 	parser.Version = Version
 
 	parser.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "debug",
-			Usage: "Enable debug message logging",
+			Usage: "Enable debug message logging (same as --log-level=debug)",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "Log messages of at least this level (debug, info, warning, error)",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "Log in this format (text, logfmt, json)",
+		},
+		cli.StringFlag{
+			Name:  "log-file",
+			Usage: "Append log messages to this file instead of writing them to stderr",
 		},
 		cli.BoolFlag{
 			Name:  "show-streams",
@@ -36,18 +53,17 @@ func Main() {
 			Name:  "show-config",
 			Usage: "Show current configuration",
 		},
+		cli.StringFlag{
+			Name:   "socket",
+			Value:  "/run/autotee.sock",
+			Usage:  "Control socket of the running instance to talk to",
+			EnvVar: "AUTOTEE_SOCKET",
+		},
 	}
 
-	parser.Action = func(c *cli.Context) error {
-
-		if c.Bool("debug") {
-			log.SetLevel(log.DebugLevel)
-		}
-		log.SetFormatter(&log.TextFormatter{
-			FullTimestamp:   true,
-			TimestampFormat: "15:04:05",
-		})
+	parser.Before = setupLogging
 
+	runAction := func(c *cli.Context) error {
 		if len(c.Args()) != 1 {
 			cli.ShowAppHelp(c)
 			os.Exit(1)
@@ -64,16 +80,26 @@ func Main() {
 			return errors.Trace(err)
 		}
 
-		if c.Bool("show-config") {
+		if c.GlobalBool("show-config") {
 			return ShowConfigMain(config)
-		} else if c.Bool("show-streams") {
+		} else if c.GlobalBool("show-streams") {
 			return ShowStreamsMain(config)
 		} else {
-			app := NewApp(rootContext, config)
+			app := NewApp(rootContext, configPath, config)
 			return errors.Trace(app.Run())
 		}
 	}
 
+	parser.Action = runAction
+	parser.Commands = append([]cli.Command{
+		{
+			Name:      "run",
+			Usage:     "Run with the given configuration file",
+			ArgsUsage: "config.yml",
+			Action:    runAction,
+		},
+	}, CtlCommands()...)
+
 	err := parser.Run(os.Args)
 	if err != nil {
 		if log.GetLevel() >= log.DebugLevel {
@@ -84,38 +110,85 @@ func Main() {
 	}
 }
 
-func ShowStreamsMain(config *Config) error {
-	server := config.Server.NewServer(config)
-	streams, err := server.GetActiveStreams()
+// setupLogging configures logging as requested by the global flags.
+func setupLogging(c *cli.Context) error {
+	level, formatter, err := parseLogFlags(c.GlobalString("log-level"), c.GlobalString("log-format"), c.GlobalBool("debug"))
 	if err != nil {
 		return err
 	}
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+
+	if path := c.GlobalString("log-file"); path != "" {
+		file, err := openLogFile(path)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(file)
+	}
+
+	return nil
+}
+
+// parseLogFlags returns the log level and formatter selected by the
+// --log-level, --log-format and --debug flags. --debug wins over --log-level.
+func parseLogFlags(levelName string, format string, debug bool) (log.Level, log.Formatter, error) {
+	level, err := log.ParseLevel(levelName)
+	if err != nil {
+		return level, nil, errors.Trace(err)
+	}
+	if debug {
+		level = log.DebugLevel
+	}
+
+	switch format {
+	case "text":
+		return level, &log.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "15:04:05",
+		}, nil
+	case "logfmt":
+		return level, &log.TextFormatter{
+			DisableColors:   true,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339Nano,
+		}, nil
+	case "json":
+		return level, &log.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		}, nil
+	default:
+		return level, nil, errors.Errorf("unknown log format: %#v", format)
+	}
+}
 
-	result := struct {
-		Url              string
-		MatchedStreams   []string
-		UnmatchedStreams []string
-	}{
-		config.Server.Url,
-		make([]string, 0),
-		make([]string, 0),
+// openLogFile opens the file given with --log-file for appending.
+func openLogFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to open log file %s", path)
 	}
+	return file, nil
+}
 
-	for stream := range streams.Iter() {
-		matched := false
-		for _, flowConfig := range config.Flows {
-			if flowConfig.Regexp.MatchString(stream.(string)) {
-				matched = true
-				break
+func ShowStreamsMain(config *Config) error {
+	streams := make(map[string]Streams, len(config.Servers))
+	for _, serverConfig := range config.Servers {
+		server := serverConfig.NewServer(serverConfig)
+		serverStreams, err := server.GetActiveStreams()
+		closeServer(server)
+		if err != nil {
+			name := serverConfig.Name
+			if name == "" {
+				name = serverConfig.Type // the only server
 			}
+			return errors.Annotatef(err, "failed to get streams of server %s", name)
 		}
-		if matched {
-			result.MatchedStreams = append(result.MatchedStreams, stream.(string))
-		} else {
-			result.UnmatchedStreams = append(result.UnmatchedStreams, stream.(string))
-		}
+		streams[serverConfig.Name] = serverStreams
 	}
 
+	result := NewStreamsReport(config, streams)
+
 	bytes, err := json.MarshalIndent(&result, "", "  ")
 	if err != nil {
 		return errors.Trace(err)
@@ -125,6 +198,60 @@ func ShowStreamsMain(config *Config) error {
 	return nil
 }
 
+// StreamsReport lists the streams of each server.
+type StreamsReport struct {
+	Servers []ServerStreamsReport
+}
+
+// ServerStreamsReport lists streams, split by whether any flow matches them,
+// and the metadata of those that have any.
+type ServerStreamsReport struct {
+	Name             string `json:",omitempty"`
+	Url              string
+	MatchedStreams   []string
+	UnmatchedStreams []string
+	Metadata         map[string]Metadata `json:",omitempty"`
+}
+
+// NewStreamsReport describes the streams of each server, which are
+// given by server name.
+func NewStreamsReport(config *Config, streams map[string]Streams) StreamsReport {
+	result := StreamsReport{make([]ServerStreamsReport, 0, len(config.Servers))}
+
+	for _, server := range config.Servers {
+		report := ServerStreamsReport{
+			server.Name,
+			server.Url,
+			make([]string, 0),
+			make([]string, 0),
+			make(map[string]Metadata),
+		}
+
+		for stream, metadata := range streams[server.Name] {
+			matched := false
+			for _, flowConfig := range config.Flows {
+				if flowConfig.Matches(server.Name, stream, metadata) {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				report.MatchedStreams = append(report.MatchedStreams, stream)
+			} else {
+				report.UnmatchedStreams = append(report.UnmatchedStreams, stream)
+			}
+			if len(metadata) > 0 {
+				report.Metadata[stream] = metadata
+			}
+		}
+
+		sort.Strings(report.MatchedStreams)
+		sort.Strings(report.UnmatchedStreams)
+		result.Servers = append(result.Servers, report)
+	}
+	return result
+}
+
 func ShowConfigMain(config *Config) error {
 
 	bytes, err := config.Dump()
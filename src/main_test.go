@@ -0,0 +1,79 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestParseLogFlags(t *testing.T) {
+	tests := []struct {
+		level  string
+		format string
+		debug  bool
+
+		ok            bool
+		expectedLevel log.Level
+		expected      log.Formatter
+	}{
+		{"info", "text", false, true, log.InfoLevel, &log.TextFormatter{FullTimestamp: true, TimestampFormat: "15:04:05"}},
+		{"warning", "logfmt", false, true, log.WarnLevel,
+			&log.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: time.RFC3339Nano}},
+		{"error", "json", false, true, log.ErrorLevel, &log.JSONFormatter{TimestampFormat: time.RFC3339Nano}},
+		{"warning", "json", true, true, log.DebugLevel, &log.JSONFormatter{TimestampFormat: time.RFC3339Nano}},
+		{"info", "xml", false, false, 0, nil},
+		{"verbose", "text", false, false, 0, nil},
+		{"verbose", "text", true, false, 0, nil},
+	}
+
+	for _, test := range tests {
+		level, formatter, err := parseLogFlags(test.level, test.format, test.debug)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("Level %#v and format %#v should have been rejected", test.level, test.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Level %#v and format %#v: %s", test.level, test.format, err)
+			continue
+		}
+		if level != test.expectedLevel {
+			t.Errorf("Level %#v with debug %v gave %s, expected %s", test.level, test.debug, level, test.expectedLevel)
+		}
+		if !reflect.DeepEqual(formatter, test.expected) {
+			t.Errorf("Format %#v gave %#v, expected %#v", test.format, formatter, test.expected)
+		}
+	}
+}
+
+func TestOpenLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autotee-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "autotee.log")
+
+	// Existing logs are appended to
+	for _, line := range []string{"one\n", "two\n"} {
+		file, err := openLogFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(line)
+		file.Close()
+	}
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "one\ntwo\n" {
+		t.Fatalf("Log file contained %#v (%v)", string(content), err)
+	}
+
+	if _, err := openLogFile(filepath.Join(dir, "missing", "autotee.log")); err == nil {
+		t.Fatal("Opening a log file in a missing directory should have failed")
+	}
+}
@@ -0,0 +1,180 @@
+package autotee
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context"
+)
+
+var influxPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999}
+var influxPercentileFields = []string{"p50", "p75", "p95", "p99", "p999", "p9999"}
+
+var influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// ReportInflux sends the metrics of a registry to InfluxDB
+// every interval, until the context is done.
+//
+// Blocks.
+func ReportInflux(ctx context.Context, registry metrics.Registry, interval time.Duration, config *InfluxConfig) {
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := postInflux(client, registry, config, now); err != nil {
+				log.WithError(err).Warn("Failed to send metrics to InfluxDB")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func postInflux(client *http.Client, registry metrics.Registry, config *InfluxConfig, now time.Time) error {
+	var body bytes.Buffer
+	if err := WriteInflux(&body, registry, now); err != nil {
+		return errors.Trace(err)
+	}
+
+	u, err := url.Parse(config.Host)
+	if err != nil {
+		return errors.Annotatef(err, "invalid InfluxDB host %#v", config.Host)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/write"
+	u.RawQuery = url.Values{"db": {config.Database}, "precision": {"s"}}.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), &body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if config.Username != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		reply, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("InfluxDB replied %s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+// WriteInflux writes the metrics of a registry in the InfluxDB line protocol.
+//
+// Like with the go-metrics InfluxDB reporter, the measurement is the metric
+// name plus its type, like "bufpool.avail.gauge". The metric labels are tags.
+func WriteInflux(w io.Writer, registry metrics.Registry, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	lines := make([]string, 0)
+
+	registry.Each(func(metricName string, i interface{}) {
+		name, labels := ParseMetricName(metricName)
+
+		add := func(kind string, fields ...string) {
+			lines = append(lines, influxMeasurement(name+"."+kind, labels)+" "+strings.Join(fields, ",")+" "+timestamp)
+		}
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			add("count", influxInt("value", m.Count()))
+		case metrics.Gauge:
+			add("gauge", influxInt("value", m.Value()))
+		case metrics.GaugeFloat64:
+			add("gauge", influxFloat("value", m.Value()))
+		case metrics.Meter:
+			s := m.Snapshot()
+			add("meter",
+				influxInt("count", s.Count()),
+				influxFloat("m1", s.Rate1()),
+				influxFloat("m5", s.Rate5()),
+				influxFloat("m15", s.Rate15()),
+				influxFloat("mean", s.RateMean()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			add("histogram", influxDistribution(s.Count(), s.Max(), s.Mean(), s.Min(), s.StdDev(), s.Variance(),
+				s.Percentiles(influxPercentiles))...)
+		case metrics.Timer:
+			s := m.Snapshot()
+			fields := influxDistribution(s.Count(), s.Max(), s.Mean(), s.Min(), s.StdDev(), s.Variance(),
+				s.Percentiles(influxPercentiles))
+			add("timer", append(fields,
+				influxFloat("m1", s.Rate1()),
+				influxFloat("m5", s.Rate5()),
+				influxFloat("m15", s.Rate15()),
+				influxFloat("meanrate", s.RateMean()))...)
+		}
+	})
+
+	sort.Strings(lines)
+
+	buffer := bufio.NewWriter(w)
+	for _, line := range lines {
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+	}
+	return buffer.Flush()
+}
+
+func influxMeasurement(name string, labels MetricLabels) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(influxMeasurementEscaper.Replace(name))
+	for _, key := range keys {
+		if labels[key] == "" {
+			continue // InfluxDB doesn't allow empty tag values
+		}
+		buffer.WriteString(",")
+		buffer.WriteString(influxTagEscaper.Replace(key))
+		buffer.WriteString("=")
+		buffer.WriteString(influxTagEscaper.Replace(labels[key]))
+	}
+	return buffer.String()
+}
+
+func influxDistribution(count, max int64, mean float64, min int64, stddev, variance float64, percentiles []float64) []string {
+	fields := []string{
+		influxInt("count", count),
+		influxInt("max", max),
+		influxFloat("mean", mean),
+		influxInt("min", min),
+		influxFloat("stddev", stddev),
+		influxFloat("variance", variance),
+	}
+	for i, field := range influxPercentileFields {
+		fields = append(fields, influxFloat(field, percentiles[i]))
+	}
+	return fields
+}
+
+func influxInt(key string, value int64) string {
+	return key + "=" + strconv.FormatInt(value, 10) + "i"
+}
+
+func influxFloat(key string, value float64) string {
+	return key + "=" + strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,36 @@
+package autotee
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWriteInflux(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	labels := MetricLabels{"flow": "video", "stream": "s1,hd", "server": ""}
+	registry.Register("bufpool.avail", metrics.NewGauge())
+	registry.Get("bufpool.avail").(metrics.Gauge).Update(3)
+	registry.Register(labels.Name("sink.stalls"), metrics.NewCounter())
+	registry.Get(labels.Name("sink.stalls")).(metrics.Counter).Inc(2)
+	registry.Register(labels.With("sink", "a b").Name("sink.stalls"), metrics.NewCounter())
+
+	var buffer bytes.Buffer
+	if err := WriteInflux(&buffer, registry, time.Unix(1500000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`bufpool.avail.gauge value=3i 1500000000`,
+		`sink.stalls.count,flow=video,sink=a\ b,stream=s1\,hd value=0i 1500000000`,
+		`sink.stalls.count,flow=video,stream=s1\,hd value=2i 1500000000`,
+		``,
+	}, "\n")
+	if buffer.String() != expected {
+		t.Fatalf("Output was:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
@@ -0,0 +1,149 @@
+package autotee
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Prefix for all exported metric names.
+const prometheusNamespace = "autotee"
+
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+var prometheusInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type prometheusFamily struct {
+	kind    string
+	samples []prometheusSample
+}
+
+type prometheusSample struct {
+	name   string
+	labels MetricLabels
+	value  float64
+}
+
+// PrometheusHandler serves the metrics of a registry in the
+// Prometheus text exposition format.
+func PrometheusHandler(registry metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := WritePrometheus(w, registry); err != nil {
+			log.WithError(err).Debug("Failed to write metrics")
+		}
+	})
+}
+
+// WritePrometheus writes the metrics of a registry in the
+// Prometheus text exposition format.
+//
+// Meters are exported as counters of their total count,
+// histograms and timers as summaries.
+func WritePrometheus(w io.Writer, registry metrics.Registry) error {
+	families := make(map[string]*prometheusFamily)
+
+	add := func(family, kind, name string, labels MetricLabels, value float64) {
+		f, ok := families[family]
+		if !ok {
+			f = &prometheusFamily{kind: kind}
+			families[family] = f
+		}
+		f.samples = append(f.samples, prometheusSample{name, labels, value})
+	}
+
+	addSummary := func(name string, labels MetricLabels, count int64, sum float64, quantiles []float64) {
+		for i, q := range prometheusQuantiles {
+			add(name, "summary", name, labels.With("quantile", strconv.FormatFloat(q, 'g', -1, 64)), quantiles[i])
+		}
+		add(name, "summary", name+"_sum", labels, sum)
+		add(name, "summary", name+"_count", labels, float64(count))
+	}
+
+	registry.Each(func(metricName string, i interface{}) {
+		baseName, labels := ParseMetricName(metricName)
+		name := prometheusName(baseName)
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			add(name+"_total", "counter", name+"_total", labels, float64(m.Count()))
+		case metrics.Gauge:
+			add(name, "gauge", name, labels, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			add(name, "gauge", name, labels, m.Value())
+		case metrics.Meter:
+			add(name+"_total", "counter", name+"_total", labels, float64(m.Snapshot().Count()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			addSummary(name, labels, s.Count(), float64(s.Sum()), s.Percentiles(prometheusQuantiles))
+		case metrics.Timer:
+			s := m.Snapshot()
+			addSummary(name, labels, s.Count(), float64(s.Sum()), s.Percentiles(prometheusQuantiles))
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		sort.Slice(family.samples, func(i, j int) bool {
+			a, b := family.samples[i], family.samples[j]
+			return a.labels.Name(a.name) < b.labels.Name(b.name)
+		})
+
+		fmt.Fprintf(buffer, "# TYPE %s %s\n", name, family.kind)
+		for _, sample := range family.samples {
+			buffer.WriteString(sample.name)
+			writePrometheusLabels(buffer, sample.labels)
+			buffer.WriteString(" ")
+			buffer.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.Flush()
+}
+
+// prometheusName turns a go-metrics name like "bufpool.avail"
+// into a Prometheus name like "autotee_bufpool_avail".
+func prometheusName(name string) string {
+	return prometheusNamespace + "_" + prometheusInvalidChars.ReplaceAllString(name, "_")
+}
+
+func writePrometheusLabels(w *bufio.Writer, labels MetricLabels) {
+	if len(labels) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString(prometheusInvalidChars.ReplaceAllString(key, "_"))
+		w.WriteString(`="`)
+		w.WriteString(prometheusLabelEscaper.Replace(labels[key]))
+		w.WriteString(`"`)
+	}
+	w.WriteString("}")
+}
@@ -0,0 +1,54 @@
+package autotee
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	labels := MetricLabels{"flow": "video", "stream": "s1,hd"}
+	registry.Register("streams", metrics.NewGauge())
+	registry.Get("streams").(metrics.Gauge).Update(3)
+	registry.Register(labels.Name("sink.stalls"), metrics.NewCounter())
+	registry.Get(labels.Name("sink.stalls")).(metrics.Counter).Inc(2)
+	registry.Register(labels.With("sink", "a").Name("sink.stalls"), metrics.NewCounter())
+
+	var buffer bytes.Buffer
+	if err := WritePrometheus(&buffer, registry); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`# TYPE autotee_sink_stalls_total counter`,
+		`autotee_sink_stalls_total{flow="video",sink="a",stream="s1,hd"} 0`,
+		`autotee_sink_stalls_total{flow="video",stream="s1,hd"} 2`,
+		`# TYPE autotee_streams gauge`,
+		`autotee_streams 3`,
+		``,
+	}, "\n")
+	if buffer.String() != expected {
+		t.Fatalf("Output was:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	labels := MetricLabels{"stream": `a,b=c\d`, "flow": "video"}
+
+	name, parsed := ParseMetricName(labels.Name("source.throughput"))
+	if name != "source.throughput" {
+		t.Fatalf("Name was %#v, expected %#v", name, "source.throughput")
+	}
+	if len(parsed) != len(labels) {
+		t.Fatalf("Labels were %#v, expected %#v", parsed, labels)
+	}
+	for key, value := range labels {
+		if parsed[key] != value {
+			t.Fatalf("Labels were %#v, expected %#v", parsed, labels)
+		}
+	}
+}
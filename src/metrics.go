@@ -0,0 +1,104 @@
+package autotee
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricLabels identify which flow, stream, sink etc. a metric belongs to.
+//
+// go-metrics only knows plain metric names, so labels are appended to
+// the name as ",key=value" pairs (like in the InfluxDB line protocol).
+// Exporters that support labels, like the Prometheus one, split them off again.
+type MetricLabels map[string]string
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`)
+
+// Name returns the go-metrics name for the metric `name` with these labels.
+func (ml MetricLabels) Name(name string) string {
+	keys := make([]string, 0, len(ml))
+	for key := range ml {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(name)
+	for _, key := range keys {
+		buffer.WriteString(",")
+		buffer.WriteString(metricLabelEscaper.Replace(key))
+		buffer.WriteString("=")
+		buffer.WriteString(metricLabelEscaper.Replace(ml[key]))
+	}
+	return buffer.String()
+}
+
+// With returns a copy of the labels with an additional label.
+func (ml MetricLabels) With(key, value string) MetricLabels {
+	result := make(MetricLabels, len(ml)+1)
+	for k, v := range ml {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// ParseMetricName splits a go-metrics name into the name and its labels.
+func ParseMetricName(s string) (string, MetricLabels) {
+	parts := splitUnescaped(s, ',')
+	labels := make(MetricLabels, len(parts)-1)
+	for _, part := range parts[1:] {
+		pair := splitUnescaped(part, '=')
+		if len(pair) != 2 {
+			continue
+		}
+		labels[unescapeMetricLabel(pair[0])] = unescapeMetricLabel(pair[1])
+	}
+	return unescapeMetricLabel(parts[0]), labels
+}
+
+// UnregisterMetrics removes all metrics that have (at least) the given labels.
+func UnregisterMetrics(registry metrics.Registry, labels MetricLabels) {
+	names := make([]string, 0)
+	registry.Each(func(name string, _ interface{}) {
+		_, metricLabels := ParseMetricName(name)
+		for key, value := range labels {
+			if metricValue, ok := metricLabels[key]; !ok || metricValue != value {
+				return
+			}
+		}
+		names = append(names, name)
+	})
+
+	for _, name := range names {
+		registry.Unregister(name)
+	}
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	result := make([]string, 0, 1)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == sep {
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, s[start:])
+}
+
+func unescapeMetricLabel(s string) string {
+	var buffer bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		buffer.WriteByte(s[i])
+	}
+	return buffer.String()
+}
@@ -0,0 +1,134 @@
+package autotee
+
+import (
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// streamsUpdate tells which streams of a server are active.
+type streamsUpdate struct {
+	server  string
+	streams Streams
+}
+
+// poller periodically gets the active streams of a server
+// and sends them to App.Run.
+type poller struct {
+	config *ServerConfig
+	server Server
+	log    *log.Entry
+
+	updates chan<- streamsUpdate
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPoller(config *ServerConfig, server Server, updates chan<- streamsUpdate) *poller {
+	entry := log.NewEntry(log.StandardLogger())
+	if config.Name != "" {
+		entry = entry.WithField("server", config.Name)
+	}
+
+	return &poller{
+		config:  config,
+		server:  server,
+		log:     entry,
+		updates: updates,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start starts polling.
+// Does not block.
+func (p *poller) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	go p.run(ctx)
+}
+
+// Stop stops polling and returns the server, which is left open.
+// Blocks.
+func (p *poller) Stop() Server {
+	p.cancel()
+	<-p.done
+	return p.server
+}
+
+func (p *poller) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+	resetTimer := NewRestartableTimer(p.config.Timeout)
+	defer resetTimer.Stop()
+
+	changed := serverChanges(p.server)
+
+	poll := func() {
+		streams, err := p.server.GetActiveStreams()
+		if err != nil {
+			Catch(err)
+			return
+		}
+		resetTimer.Restart()
+		p.send(ctx, streams)
+	}
+
+	poll()
+	for {
+		select {
+		case <-resetTimer.C:
+			p.log.Warn("No reply from server, assuming all streams gone")
+			resetTimer.Stop()
+			p.send(ctx, make(Streams))
+
+		case <-ticker.C:
+			poll()
+
+		case <-changed: // nil unless server is a Notifier
+			poll()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *poller) send(ctx context.Context, streams Streams) {
+	select {
+	case p.updates <- streamsUpdate{p.config.Name, streams}:
+	case <-ctx.Done():
+	}
+}
+
+// replaceServer returns the server to use after the configuration changed:
+// the old one, if it can be reconfigured, or a new one.
+func replaceServer(old Server, config *ServerConfig) Server {
+	if old == nil {
+		return config.NewServer(config)
+	}
+	if server, ok := old.(Reconfigurable); ok && server.Reconfigure(config) {
+		return old
+	}
+	closeServer(old)
+	return config.NewServer(config)
+}
+
+func closeServer(server Server) {
+	if closer, ok := server.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close server")
+		}
+	}
+}
+
+// serverChanges returns the channel of a Notifier, or nil for other servers.
+func serverChanges(server Server) <-chan struct{} {
+	if notifier, ok := server.(Notifier); ok {
+		return notifier.Changed()
+	}
+	return nil
+}
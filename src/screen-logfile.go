@@ -0,0 +1,104 @@
+package autotee
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+)
+
+// LogFileScreenService writes the output of processes to a log file,
+// instead of showing it in a screen.
+//
+// The log file is rotated when it gets too large. Shared and exclusive
+// services behave the same, except that an exclusive one closes the
+// log file whenever Done() is called.
+type LogFileScreenService struct {
+	path      string
+	config    *ConsoleConfig
+	exclusive bool
+
+	// Processes write to pipe, a goroutine copies from it to the log file
+	pipe   *os.File
+	copied chan struct{}
+	screen *Screen
+}
+
+func NewLogFileScreenService(config *ConsoleConfig, id ProcessId, shared bool) ScreenService {
+	return &LogFileScreenService{
+		path:      filepath.Join(config.LogDir, logFileName(id)),
+		config:    config,
+		exclusive: !shared,
+	}
+}
+
+func (s *LogFileScreenService) Screen() (*Screen, error) {
+	if s.screen != nil {
+		if !s.exclusive {
+			return s.screen, nil
+		}
+		log.Warn("Bug: Done() not called")
+		s.close()
+	}
+
+	file, err := OpenRotatingFile(s.path, s.config.LogMaxSize, s.config.LogMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		file.Close()
+		return nil, errors.Annotate(err, "Failed to create pipe")
+	}
+
+	s.pipe = w
+	s.copied = make(chan struct{})
+	go func(copied chan struct{}) {
+		defer close(copied)
+		io.Copy(file, r)
+		r.Close()
+		file.Close()
+	}(s.copied)
+
+	s.screen = &Screen{s.path, w}
+	return s.screen, nil
+}
+
+func (s *LogFileScreenService) Done() error {
+	if s.exclusive {
+		s.close()
+	}
+	return nil
+}
+
+func (s *LogFileScreenService) Stop() {
+	s.close()
+}
+
+// close closes our end of the pipe and waits until everything
+// the processes wrote to it is in the log file.
+func (s *LogFileScreenService) close() {
+	if s.screen != nil {
+		s.screen = nil
+		s.pipe.Close()
+		<-s.copied
+	}
+}
+
+var logFileNameEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "/", "%2F")
+
+// logFileName returns a file name like "server.stream.flow.sink.log".
+//
+// Dots, slashes and percent signs in the parts are escaped, so that
+// each process gets its own file.
+func logFileName(id ProcessId) string {
+	parts := id.parts()
+	for i, part := range parts {
+		parts[i] = logFileNameEscaper.Replace(part)
+	}
+	return strings.Join(parts, ".") + ".log"
+}
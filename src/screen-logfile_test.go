@@ -0,0 +1,32 @@
+package autotee
+
+import (
+	"testing"
+)
+
+func TestLogFileName(t *testing.T) {
+	tests := []struct {
+		id       ProcessId
+		expected string
+	}{
+		{ProcessId{Stream: "s1", Flow: "hd"}, "s1.hd.log"},
+		{ProcessId{Server: "main", Stream: "s1", Flow: "hd", Sink: "rec"}, "main.s1.hd.rec.log"},
+		{ProcessId{Stream: "a.b", Flow: "c"}, "a%2Eb.c.log"},
+		{ProcessId{Stream: "a", Flow: "b.c"}, "a.b%2Ec.log"},
+		{ProcessId{Stream: "live/s1", Flow: "hd"}, "live%2Fs1.hd.log"},
+		{ProcessId{Stream: "live_s1", Flow: "hd"}, "live_s1.hd.log"},
+		{ProcessId{Stream: "a%2Eb", Flow: "c"}, "a%252Eb.c.log"},
+	}
+
+	names := make(map[string]ProcessId)
+	for _, test := range tests {
+		name := logFileName(test.id)
+		if name != test.expected {
+			t.Errorf("Log file of %+v was %#v, expected %#v", test.id, name, test.expected)
+		}
+		if other, ok := names[name]; ok {
+			t.Errorf("%+v and %+v have the same log file %#v", other, test.id, name)
+		}
+		names[name] = test.id
+	}
+}
@@ -0,0 +1,182 @@
+package autotee
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/kr/pty"
+)
+
+// Serializes creating the tmux session and windows in it, so that
+// concurrent TmuxScreenServices don't all try to create the session.
+var tmuxLock sync.Mutex
+
+// TmuxScreenService shows the output of processes in windows of a tmux session.
+//
+// All services of an autotee instance share one session, "autotee-$pid".
+// Each window is named after the process, like "$server/$stream/$flow/$sink",
+// and runs cat, which reads what the processes write to a PTY.
+//
+// Shared services keep using the same window, exclusive ones
+// open a new one for each process and close it when Done() is called.
+type TmuxScreenService struct {
+	session   string
+	window    string
+	exclusive bool
+
+	pty, tty *os.File
+	windowId string
+	screen   *Screen
+}
+
+func NewTmuxScreenService(id ProcessId, shared bool) ScreenService {
+	return &TmuxScreenService{
+		session:   tmuxSessionName(os.Getpid()),
+		window:    tmuxWindowName(id),
+		exclusive: !shared,
+	}
+}
+
+// tmuxSessionName returns the name of the session of an autotee instance.
+func tmuxSessionName(pid int) string {
+	return fmt.Sprintf("autotee-%d", pid)
+}
+
+// tmuxWindowName returns a name like "server/stream/flow/sink".
+func tmuxWindowName(id ProcessId) string {
+	return strings.Join(id.parts(), "/")
+}
+
+func (s *TmuxScreenService) Screen() (*Screen, error) {
+	if s.screen != nil {
+		if !s.exclusive {
+			return s.screen, nil
+		}
+		log.Warn("Bug: Done() not called")
+		s.close()
+	}
+
+	if err := s.spawn(); err != nil {
+		return nil, err
+	}
+	return s.screen, nil
+}
+
+func (s *TmuxScreenService) Done() error {
+	if s.exclusive {
+		return s.close()
+	}
+	return nil
+}
+
+func (s *TmuxScreenService) Stop() {
+	if err := s.close(); err != nil {
+		log.WithError(err).Warn("Failed to stop tmux window")
+	}
+}
+
+func (s *TmuxScreenService) spawn() error {
+	var err error
+
+	// Create PTY/TTY pair. Processes write to the PTY, cat reads from the TTY.
+	s.pty, s.tty, err = pty.Open()
+	if err != nil {
+		return errors.Annotate(err, "Failed to create PTY")
+	}
+	if err := disableEcho(s.tty); err != nil {
+		s.pty.Close()
+		s.tty.Close()
+		return errors.Annotate(err, "Failed to configure TTY")
+	}
+
+	s.windowId, err = newTmuxWindow(s.session, s.window, tmuxCatCommand(s.tty.Name()))
+	if err != nil {
+		s.pty.Close()
+		s.tty.Close()
+		return errors.Annotate(err, "Failed to start tmux window")
+	}
+
+	s.screen = &Screen{s.session + ":" + s.window, s.pty}
+	return nil
+}
+
+func (s *TmuxScreenService) close() error {
+	if s.screen == nil {
+		return nil
+	}
+	s.screen = nil
+
+	// Closing the PTY ends cat, which closes the window.
+	// Kill it anyway, in case cat got stuck.
+	s.pty.Close()
+	s.tty.Close()
+	if _, err := tmux("kill-window", "-t", s.windowId); err != nil && tmuxHasWindow(s.windowId) {
+		return err
+	}
+	return nil
+}
+
+// newTmuxWindow opens a window running command in the background,
+// creating the session if necessary, and returns its window id.
+func newTmuxWindow(session, name, command string) (string, error) {
+	tmuxLock.Lock()
+	defer tmuxLock.Unlock()
+
+	// The session goes away when its last window is closed
+	_, hasErr := tmux("has-session", "-t", "="+session)
+	out, err := tmux(newTmuxWindowArgs(session, name, command, hasErr == nil)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// tmuxCatCommand returns the shell command of a window that shows what is written to a TTY.
+func tmuxCatCommand(tty string) string {
+	return "exec cat " + tty
+}
+
+// newTmuxWindowArgs returns the tmux arguments that open a window in the
+// background and print its id: in the session if it exists, or in a new one.
+func newTmuxWindowArgs(session, name, command string, sessionExists bool) []string {
+	if sessionExists {
+		return []string{"new-window", "-d", "-P", "-F", "#{window_id}", "-t", "=" + session + ":", "-n", name, command}
+	}
+	return []string{"new-session", "-d", "-P", "-F", "#{window_id}", "-s", session, "-n", name, command}
+}
+
+func tmuxHasWindow(windowId string) bool {
+	_, err := tmux("list-panes", "-t", windowId)
+	return err == nil
+}
+
+// tmux runs a tmux command and returns its output.
+func tmux(args ...string) (string, error) {
+	out, err := exec.Command("tmux", args...).CombinedOutput()
+	if err != nil {
+		return "", errors.Annotatef(err, "tmux %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// disableEcho keeps the TTY from echoing what is written to the PTY back to it
+// (where nobody would read it) and passes input on without waiting for newlines.
+func disableEcho(tty *os.File) error {
+	var termios syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return errors.Trace(errno)
+	}
+
+	termios.Lflag &^= syscall.ECHO | syscall.ICANON
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return errors.Trace(errno)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package autotee
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTmuxNames(t *testing.T) {
+	if name := tmuxSessionName(1234); name != "autotee-1234" {
+		t.Errorf("Session name was %#v, expected \"autotee-1234\"", name)
+	}
+
+	tests := []struct {
+		id       ProcessId
+		expected string
+	}{
+		{ProcessId{Stream: "s1", Flow: "hd"}, "s1/hd"},
+		{ProcessId{Stream: "s1", Flow: "hd", Sink: "rec"}, "s1/hd/rec"},
+		{ProcessId{Server: "main", Stream: "s1", Flow: "hd", Sink: "rec"}, "main/s1/hd/rec"},
+	}
+	for _, test := range tests {
+		if name := tmuxWindowName(test.id); name != test.expected {
+			t.Errorf("Window name of %+v was %#v, expected %#v", test.id, name, test.expected)
+		}
+	}
+}
+
+func TestTmuxScreenService(t *testing.T) {
+	s := NewTmuxScreenService(ProcessId{Stream: "s1", Flow: "hd", Sink: "rec"}, false).(*TmuxScreenService)
+
+	if expected := "autotee-" + strconv.Itoa(os.Getpid()); s.session != expected {
+		t.Errorf("Session was %#v, expected %#v", s.session, expected)
+	}
+	if s.window != "s1/hd/rec" {
+		t.Errorf("Window was %#v, expected \"s1/hd/rec\"", s.window)
+	}
+	if !s.exclusive {
+		t.Error("Service should have been exclusive")
+	}
+
+	// Without a screen, nothing is run
+	if err := s.Done(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewTmuxWindowArgs(t *testing.T) {
+	if command := tmuxCatCommand("/dev/pts/3"); command != "exec cat /dev/pts/3" {
+		t.Errorf("Window command was %#v, expected \"exec cat /dev/pts/3\"", command)
+	}
+
+	tests := []struct {
+		sessionExists bool
+		expected      []string
+	}{
+		{false, []string{"new-session", "-d", "-P", "-F", "#{window_id}", "-s", "autotee-1", "-n", "s1/hd", "exec cat /dev/pts/3"}},
+		{true, []string{"new-window", "-d", "-P", "-F", "#{window_id}", "-t", "=autotee-1:", "-n", "s1/hd", "exec cat /dev/pts/3"}},
+	}
+	for _, test := range tests {
+		args := newTmuxWindowArgs("autotee-1", "s1/hd", "exec cat /dev/pts/3", test.sessionExists)
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("Arguments with existing session %v were %#v, expected %#v", test.sessionExists, args, test.expected)
+		}
+	}
+}
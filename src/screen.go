@@ -1,8 +1,11 @@
 package autotee
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
@@ -14,12 +17,92 @@ type Screen struct {
 	File *os.File
 }
 
+// GetName returns the name of the screen, or "" for no screen (in headless mode).
+func (s *Screen) GetName() string {
+	if s == nil {
+		return ""
+	}
+	return s.Name
+}
+
+// stderrOutput returns where the stderr output of a process goes:
+// its screen, or the log in headless mode (screen is nil).
+func stderrOutput(screen *Screen, entry *log.Entry) io.Writer {
+	if screen == nil {
+		return NewLogWriter(entry)
+	}
+	return screen.File
+}
+
 type ScreenService interface {
 	Screen() (*Screen, error)
 	Done() error
 	Stop()
 }
 
+// ProcessId identifies a supervised process.
+// Server is empty if there's only one, Sink is empty for sources.
+type ProcessId struct {
+	Server string
+	Stream string
+	Flow   string
+	Sink   string
+}
+
+// NewScreenService returns a ScreenService of the configured type for a process,
+// or a NullScreenService in headless mode.
+//
+// Shared services reuse the same screen for all processes they're asked for,
+// exclusive ones start a new one for each.
+func (cc *ConsoleConfig) NewScreenService(id ProcessId, shared bool) ScreenService {
+	switch cc.Type {
+	case "logfile":
+		return NewLogFileScreenService(cc, id, shared)
+	case "tmux":
+		return NewTmuxScreenService(id, shared)
+	case "none":
+		return NullScreenService{}
+	default:
+		if shared {
+			return NewSharedScreenService(id.ScreenName())
+		}
+		return NewExclusiveScreenService(id.ScreenName())
+	}
+}
+
+// NullScreenService is the ScreenService of headless mode.
+// Its screens are nil, so processes log their stderr output instead.
+type NullScreenService struct{}
+
+func (NullScreenService) Screen() (*Screen, error) {
+	return nil, nil
+}
+
+func (NullScreenService) Done() error {
+	return nil
+}
+
+func (NullScreenService) Stop() {
+}
+
+// ScreenName returns a name like "autotee:$pid:$server:$stream:$flow:$sink".
+func (id ProcessId) ScreenName() string {
+	return fmt.Sprintf("autotee:%d:%s", os.Getpid(), strings.Join(id.parts(), ":"))
+}
+
+// parts returns the non-empty parts of the id, from server to sink.
+func (id ProcessId) parts() []string {
+	parts := make([]string, 0, 4)
+	if id.Server != "" {
+		parts = append(parts, id.Server)
+	}
+	parts = append(parts, id.Stream, id.Flow)
+	if id.Sink != "" {
+		parts = append(parts, id.Sink)
+	}
+	return parts
+}
+
 type BaseScreenService struct {
 	name     string
 	cmd      *Cmd
@@ -0,0 +1,75 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// logRecorder is a logrus hook that keeps all entries.
+type logRecorder struct {
+	lock    sync.Mutex
+	entries []*log.Entry
+}
+
+func (r *logRecorder) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (r *logRecorder) Fire(entry *log.Entry) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *logRecorder) Entries() []*log.Entry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*log.Entry(nil), r.entries...)
+}
+
+func TestHeadlessStderrLogged(t *testing.T) {
+	recorder := &logRecorder{}
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(recorder)
+	entry := log.NewEntry(logger).WithFields(log.Fields{"stream": "s1", "name": "hd"})
+
+	id := ProcessId{Stream: "s1", Flow: "hd", Sink: "rec"}
+	screen, err := NullScreenService{}.Screen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command := CmdData{"sh", []string{"-c", "echo one >&2; printf two >&2"}}
+	sink := NewSink(context.Background(), entry, "rec", command, &BufferConfig{BufferCount: 1},
+		screen, NewLineRing(10), NewWebhooks(nil).For(id), NewSinkMetrics(MetricLabels{"sink": "headless-test"}))
+	if err := sink.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Stop()
+
+	// The sink keeps running until it's stopped, wait for the output instead
+	var lines []string
+	for deadline := time.Now().Add(5 * time.Second); len(lines) < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		lines = nil
+		for _, e := range recorder.Entries() {
+			if e.Data["output"] != "stderr" {
+				continue
+			}
+			if e.Data["stream"] != "s1" || e.Data["name"] != "hd" || e.Data["sink"] != "rec" {
+				t.Fatalf("Entry %#v had fields %#v", e.Message, e.Data)
+			}
+			lines = append(lines, e.Message)
+		}
+	}
+	if len(lines) != 2 || lines[0] != "one" || lines[1] != "two" {
+		t.Fatalf("Logged lines were %#v, expected \"one\" and \"two\"", lines)
+	}
+}
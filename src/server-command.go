@@ -0,0 +1,94 @@
+package autotee
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// How long to wait for a command server program after killing it.
+// Its output can be kept open by children that left its process group.
+const commandKillWait = time.Second
+
+// CommandServer gets the active streams from a program that it runs for each poll.
+//
+// The program prints one stream name per line, or, with the json format,
+// a JSON list of stream names. It is killed if it takes longer than the
+// request timeout. Exiting with a non-zero status makes the poll fail.
+type CommandServer struct {
+	config *ServerConfig
+}
+
+func NewCommandServer(config *ServerConfig) Server {
+	return &CommandServer{config}
+}
+
+func (cs *CommandServer) GetActiveStreams() (Streams, error) {
+	name := cs.config.Command.Name
+
+	var stdout bytes.Buffer
+	stderr := NewLineRing(stderrLogLines)
+	cmd := Command(name, cs.config.Command.Args...)
+	cmd.SetStdout(&stdout)
+	if err := cmd.TeeStderr(stderr); err != nil {
+		return nil, errors.Annotate(err, "failed to create pipe")
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Annotatef(err, "failed to start %s", name)
+	}
+
+	// No timeout => nil channel
+	var timeout <-chan time.Time
+	if cs.config.RequestTimeout > 0 {
+		timer := time.NewTimer(cs.config.RequestTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	wait := cmd.WaitChannel()
+	select {
+	case err := <-wait:
+		if err != nil {
+			if tail := stderrTail(stderr); tail != "" {
+				return nil, errors.Annotatef(err, "%s failed: %s", name, tail)
+			}
+			return nil, errors.Annotatef(err, "%s failed", name)
+		}
+
+	case <-timeout:
+		cmd.KillGroup()
+		select {
+		case <-wait:
+		case <-time.After(commandKillWait):
+		}
+		return nil, errors.Errorf("%s did not finish within %v", name, cs.config.RequestTimeout)
+	}
+
+	return parseStreamList(stdout.Bytes(), cs.config.Format)
+}
+
+// parseStreamList parses the output of a command server.
+func parseStreamList(output []byte, format string) (Streams, error) {
+	result := make(Streams)
+
+	if format == "json" {
+		var names []string
+		if err := json.Unmarshal(output, &names); err != nil {
+			return nil, errors.Annotate(err, "failed to parse stream list")
+		}
+		for _, name := range names {
+			result[name] = nil
+		}
+		return result, nil
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			result[name] = nil
+		}
+	}
+	return result, nil
+}
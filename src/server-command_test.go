@@ -0,0 +1,78 @@
+package autotee
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommandServer(t *testing.T) {
+	tests := []struct {
+		command  string
+		format   string
+		expected []string
+	}{
+		{`printf 's1\n\n  s2  \ns1\n'`, "lines", []string{"s1", "s2"}},
+		{`printf ''`, "lines", []string{}},
+		{`echo '["s1", "s3"]'`, "json", []string{"s1", "s3"}},
+		{`echo '[]'`, "json", []string{}},
+	}
+
+	for _, test := range tests {
+		config := &ServerConfig{
+			Command:        CmdData{"sh", []string{"-c", test.command}},
+			Format:         test.format,
+			RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+		}
+		result := activeStreamNames(t, NewCommandServer(config))
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Command %s gave streams %#v, expected %#v", test.command, result, test.expected)
+		}
+	}
+}
+
+func TestCommandServerFailure(t *testing.T) {
+	tests := []struct {
+		command string
+		format  string
+	}{
+		{`echo s1; exit 1`, "lines"},
+		{`echo 'not json'`, "json"},
+		{`sleep 10`, "lines"},
+	}
+
+	for _, test := range tests {
+		config := &ServerConfig{
+			Command:        CmdData{"sh", []string{"-c", test.command}},
+			Format:         test.format,
+			RequestTimeout: 200 * time.Millisecond,
+		}
+		if _, err := NewCommandServer(config).GetActiveStreams(); err == nil {
+			t.Errorf("Command %s should have failed", test.command)
+		}
+	}
+}
+
+func TestCommandServerLingeringChild(t *testing.T) {
+	// The child keeps stdout open after the program was killed
+	config := &ServerConfig{
+		Command:        CmdData{"sh", []string{"-c", "setsid sleep 3 & sleep 10"}},
+		Format:         "lines",
+		RequestTimeout: 200 * time.Millisecond,
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := NewCommandServer(config).GetActiveStreams()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Command should have failed")
+		}
+	case <-time.After(config.RequestTimeout + commandKillWait + time.Second):
+		t.Fatal("Polling should not wait for the child")
+	}
+}
@@ -5,33 +5,54 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/deckarep/golang-set"
+	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 )
 
-type IcecastUrls struct {
-	mapset.Set
+// IcecastSources are the sources (mounts) listed in an Icecast status-json document.
+type IcecastSources []IcecastSource
+
+// IcecastSource describes a source (mount) of an Icecast server.
+type IcecastSource struct {
+	Mount       string
+	ServerName  string
+	ContentType string
+	Bitrate     string
+	Listeners   string
 }
 
 type Icecast struct {
-	config *Config
+	config *ServerConfig
 	client http.Client
+
+	// Mounts of the sources that couldn't be named after their
+	// server_name at the last poll, to only warn when they change.
+	collisions string
 }
 
-func NewIcecast(config *Config) Server {
+func NewIcecast(config *ServerConfig) Server {
 	return &Icecast{
 		config: config,
-		client: http.Client{Timeout: config.Times.ServerRequestTimeout},
+		client: http.Client{Timeout: config.RequestTimeout},
 	}
 }
 
-// Get a list of active streams of a specific app from an Icecast server.
-func (nr *Icecast) GetActiveStreams() (mapset.Set, error) {
+// Get a list of active streams from an Icecast server, optionally only
+// those with a mount below a prefix or one of the configured content types.
+//
+// Streams are named after their mount (without the leading slash),
+// or after their server_name. Sources without a server_name keep their
+// mount, and so do sources whose names would collide: those with a
+// server_name that other sources have too, or that is another sources
+// mount, and the other source.
+func (nr *Icecast) GetActiveStreams() (Streams, error) {
 
 	// Make HTTP request
-	resp, err := nr.client.Get(nr.config.Server.Url)
+	resp, err := nr.client.Get(nr.config.Url)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -42,16 +63,94 @@ func (nr *Icecast) GetActiveStreams() (mapset.Set, error) {
 		return nil, errors.Trace(err)
 	}
 
-	urls := IcecastUrls{mapset.NewSet()}
-	err = json.Unmarshal(bytes, &urls)
+	var sources IcecastSources
+	err = json.Unmarshal(bytes, &sources)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	return urls.Set, nil
+	var matching IcecastSources
+	for _, source := range sources {
+		if nr.matches(source) {
+			matching = append(matching, source)
+		}
+	}
+
+	if nr.config.NameField != "server_name" {
+		result := make(Streams)
+		for _, source := range matching {
+			result[source.Mount] = source.metadata()
+		}
+		return result, nil
+	}
+
+	serverNames := make(map[string]int)
+	mounts := make(map[string]bool)
+	for _, source := range matching {
+		if source.ServerName != "" {
+			serverNames[source.ServerName]++
+		}
+		mounts[source.Mount] = true
+	}
+
+	result := make(Streams)
+	var collisions []string
+	for _, source := range matching {
+		name := source.ServerName
+		collides := serverNames[name] > 1 ||
+			(name != source.Mount && mounts[name]) ||
+			(name != source.Mount && serverNames[source.Mount] > 0)
+		if name == "" || collides {
+			name = source.Mount
+		}
+		if collides {
+			collisions = append(collisions, source.Mount)
+		}
+		result[name] = source.metadata()
+	}
+
+	sort.Strings(collisions)
+	if joined := strings.Join(collisions, ", "); joined != nr.collisions {
+		nr.collisions = joined
+		if joined != "" {
+			log.WithField("mounts", joined).Warn("Sources have the same server_name, or one that is another mount, using their mounts instead")
+		}
+	}
+	return result, nil
 }
 
-func (iu *IcecastUrls) UnmarshalJSON(bytes []byte) error {
+func (nr *Icecast) matches(source IcecastSource) bool {
+	if !strings.HasPrefix(source.Mount, strings.TrimLeft(nr.config.MountPrefix, "/")) {
+		return false
+	}
+	if len(nr.config.ContentTypes) == 0 {
+		return true
+	}
+	for _, contentType := range nr.config.ContentTypes {
+		if strings.HasPrefix(source.ContentType, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (is *IcecastSource) metadata() Metadata {
+	metadata := Metadata{
+		"bitrate":      is.Bitrate,
+		"listeners":    is.Listeners,
+		"content_type": is.ContentType,
+	}
+
+	// Leave out what Icecast didn't tell
+	for key, value := range metadata {
+		if value == "" {
+			delete(metadata, key)
+		}
+	}
+	return metadata
+}
+
+func (is *IcecastSources) UnmarshalJSON(bytes []byte) error {
 
 	var aux struct {
 		Icestats struct {
@@ -74,12 +173,12 @@ func (iu *IcecastUrls) UnmarshalJSON(bytes []byte) error {
 
 	// Exactly one source?
 	default:
-		return iu.addSourceObj(obj)
+		return is.addSourceObj(obj)
 
 	// More than one source?
 	case []interface{}:
 		for _, subobj := range obj {
-			if err := iu.addSourceObj(subobj); err != nil {
+			if err := is.addSourceObj(subobj); err != nil {
 				return errors.Trace(err)
 			}
 		}
@@ -87,7 +186,7 @@ func (iu *IcecastUrls) UnmarshalJSON(bytes []byte) error {
 	}
 }
 
-func (iu *IcecastUrls) addSourceObj(sourceObj interface{}) error {
+func (is *IcecastSources) addSourceObj(sourceObj interface{}) error {
 	m, ok := sourceObj.(map[string]interface{})
 	if !ok {
 		return errors.New("source wasn't a JSON object")
@@ -104,10 +203,34 @@ func (iu *IcecastUrls) addSourceObj(sourceObj interface{}) error {
 	}
 
 	url, err := url.Parse(urlStr)
-	if !ok {
+	if err != nil {
 		return errors.Annotate(err, "failed to parse listenurl")
 	}
 
-	iu.Add(strings.TrimLeft(url.Path, "/"))
+	// Older versions only have ice-bitrate
+	bitrate := icecastField(m, "bitrate")
+	if bitrate == "" {
+		bitrate = icecastField(m, "ice-bitrate")
+	}
+
+	*is = append(*is, IcecastSource{
+		Mount:       strings.TrimLeft(url.Path, "/"),
+		ServerName:  icecastField(m, "server_name"),
+		ContentType: icecastField(m, "server_type"),
+		Bitrate:     bitrate,
+		Listeners:   icecastField(m, "listeners"),
+	})
 	return nil
 }
+
+// icecastField returns a string or number field of a source, or "".
+func icecastField(m map[string]interface{}, key string) string {
+	switch value := m[key].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
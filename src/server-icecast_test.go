@@ -0,0 +1,147 @@
+package autotee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestIcecast(t *testing.T) {
+	fixture := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer fixture.Close()
+
+	s1Native := Metadata{"bitrate": "128", "listeners": "9", "content_type": "audio/mpeg"}
+	s1Translated := Metadata{"bitrate": "96", "listeners": "2", "content_type": "application/ogg"}
+	lofi := Metadata{"bitrate": "64", "listeners": "0", "content_type": "audio/mpeg"}
+
+	tests := []struct {
+		file         string
+		mountPrefix  string
+		contentTypes []string
+		nameField    string
+		expected     Streams
+	}{
+		{"icecast-status-none.json", "", nil, "mount", Streams{}},
+		{"icecast-status-single.json", "", nil, "mount", Streams{
+			"s2_native.mp3": {"bitrate": "128", "listeners": "1", "content_type": "audio/mpeg"},
+		}},
+		{"icecast-status-multiple.json", "", nil, "mount", Streams{
+			"s1_native.mp3":      s1Native,
+			"s1_translated.opus": s1Translated,
+			"test/lofi.mp3":      lofi,
+		}},
+		{"icecast-status-multiple.json", "/s1_", nil, "mount", Streams{
+			"s1_native.mp3":      s1Native,
+			"s1_translated.opus": s1Translated,
+		}},
+		{"icecast-status-multiple.json", "", []string{"audio/"}, "mount", Streams{
+			"s1_native.mp3": s1Native,
+			"test/lofi.mp3": lofi,
+		}},
+		{"icecast-status-multiple.json", "s1_", []string{"application/ogg", "video/"}, "mount", Streams{
+			"s1_translated.opus": s1Translated,
+		}},
+		// Sources without a server_name keep their mount
+		{"icecast-status-multiple.json", "", nil, "server_name", Streams{
+			"saal1-native":     s1Native,
+			"saal1-translated": s1Translated,
+			"test/lofi.mp3":    lofi,
+		}},
+		// Sources with the same server_name keep their mount too
+		{"icecast-status-duplicate.json", "", nil, "server_name", Streams{
+			"s1_native.mp3":      s1Native,
+			"s1_translated.opus": s1Translated,
+			"saal2":              lofi,
+		}},
+		{"icecast-status-duplicate.json", "/s1_native", nil, "server_name", Streams{
+			"saal1": s1Native,
+		}},
+		// So do sources with a server_name that is another mount, and the
+		// other source. A server_name that is the own mount is fine.
+		{"icecast-status-mountname.json", "", nil, "server_name", Streams{
+			"s1_native.mp3":      s1Native,
+			"lofi":               lofi,
+			"s1_translated.opus": s1Translated,
+		}},
+		{"icecast-status-mountname.json", "", []string{"audio/"}, "server_name", Streams{
+			"s1_native.mp3": s1Native,
+			"lofi":          lofi,
+		}},
+		{"icecast-status-mountname.json", "/s1_", nil, "server_name", Streams{
+			"lofi":               s1Native,
+			"s1_translated.opus": s1Translated,
+		}},
+	}
+
+	for _, test := range tests {
+		config := &ServerConfig{
+			Url:            fixture.URL + "/" + test.file,
+			MountPrefix:    test.mountPrefix,
+			ContentTypes:   test.contentTypes,
+			NameField:      test.nameField,
+			RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+		}
+		streams, err := NewIcecast(config).GetActiveStreams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(streams, test.expected) {
+			t.Errorf("%s with prefix %#v, types %#v and names from %s gave %#v, expected %#v",
+				test.file, test.mountPrefix, test.contentTypes, test.nameField, streams, test.expected)
+		}
+	}
+}
+
+func TestIcecastCollisionsLoggedOnce(t *testing.T) {
+	fixture := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer fixture.Close()
+
+	recorder := &logRecorder{}
+	hooks := log.StandardLogger().Hooks
+	log.StandardLogger().Hooks = make(log.LevelHooks)
+	log.AddHook(recorder)
+	defer func() { log.StandardLogger().Hooks = hooks }()
+
+	config := &ServerConfig{
+		NameField:      "server_name",
+		RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+	}
+	server := NewIcecast(config)
+
+	tests := []struct {
+		file     string
+		warnings int
+	}{
+		{"icecast-status-duplicate.json", 1},
+		{"icecast-status-duplicate.json", 1},
+		{"icecast-status-mountname.json", 2},
+		{"icecast-status-multiple.json", 2},
+		{"icecast-status-duplicate.json", 3},
+	}
+	for i, test := range tests {
+		config.Url = fixture.URL + "/" + test.file
+		if _, err := server.GetActiveStreams(); err != nil {
+			t.Fatal(err)
+		}
+		if warnings := len(recorder.Entries()); warnings != test.warnings {
+			t.Fatalf("Poll %d (%s) made %d warnings in total, expected %d", i, test.file, warnings, test.warnings)
+		}
+	}
+}
+
+func TestIcecastInvalidListenUrl(t *testing.T) {
+	fixture := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer fixture.Close()
+
+	config := &ServerConfig{
+		Url:            fixture.URL + "/icecast-status-badurl.json",
+		NameField:      "mount",
+		RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+	}
+	if _, err := NewIcecast(config).GetActiveStreams(); err == nil {
+		t.Fatal("Invalid listenurl should have been reported")
+	}
+}
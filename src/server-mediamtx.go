@@ -0,0 +1,79 @@
+package autotee
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// How many paths to ask MediaMTX for at once.
+const mediaMtxPageSize = 100
+
+// MediaMtx gets the paths with a ready source from the HTTP API of a MediaMTX
+// (formerly rtsp-simple-server) server, optionally only those whose source
+// is of one of the configured types (like "rtspSession" or "srtConn").
+type MediaMtx struct {
+	config *ServerConfig
+	client http.Client
+}
+
+type mediaMtxPath struct {
+	Name   string `json:"name"`
+	Source *struct {
+		Type string `json:"type"`
+	} `json:"source"`
+	Ready bool `json:"ready"`
+
+	// Called "ready" since v1.0
+	SourceReady bool `json:"sourceReady"`
+}
+
+func NewMediaMtx(config *ServerConfig) Server {
+	return &MediaMtx{
+		config: config,
+		client: http.Client{Timeout: config.RequestTimeout},
+	}
+}
+
+// Get a list of paths that have a ready source.
+func (m *MediaMtx) GetActiveStreams() (Streams, error) {
+	result := make(Streams)
+	for page := 0; ; page++ {
+		var aux struct {
+			PageCount int            `json:"pageCount"`
+			Items     []mediaMtxPath `json:"items"`
+		}
+		if err := getJSON(&m.client, m.url(fmt.Sprintf("/v3/paths/list?page=%d&itemsPerPage=%d", page, mediaMtxPageSize)), &aux); err != nil {
+			return nil, err
+		}
+
+		for _, path := range aux.Items {
+			if m.matches(path) {
+				result[path.Name] = nil
+			}
+		}
+
+		if page+1 >= aux.PageCount {
+			return result, nil
+		}
+	}
+}
+
+func (m *MediaMtx) matches(path mediaMtxPath) bool {
+	if (!path.Ready && !path.SourceReady) || path.Source == nil {
+		return false
+	}
+	if len(m.config.SourceTypes) == 0 {
+		return true
+	}
+	for _, sourceType := range m.config.SourceTypes {
+		if path.Source.Type == sourceType {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MediaMtx) url(path string) string {
+	return strings.TrimRight(m.config.Url, "/") + path
+}
@@ -0,0 +1,40 @@
+package autotee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMediaMtx(t *testing.T) {
+	fixture := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/paths/list" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "testdata/mediamtx-paths.json")
+	}))
+	defer fixture.Close()
+
+	tests := []struct {
+		sourceTypes []string
+		expected    []string
+	}{
+		{nil, []string{"s1_native_hd", "s2_native_hd"}},
+		{[]string{"srtConn"}, []string{"s1_native_hd"}},
+		{[]string{"rtmpConn", "rtspSession"}, []string{"s2_native_hd"}},
+	}
+
+	for _, test := range tests {
+		config := &ServerConfig{
+			Url:            fixture.URL,
+			SourceTypes:    test.sourceTypes,
+			RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+		}
+		result := activeStreamNames(t, NewMediaMtx(config))
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("source types %#v: expected %#v, got %#v", test.sourceTypes, test.expected, result)
+		}
+	}
+}
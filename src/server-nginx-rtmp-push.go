@@ -0,0 +1,255 @@
+package autotee
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+)
+
+// NginxRtmpPush learns about streams from the on_publish and
+// on_publish_done (or on_done) callbacks of an nginx-rtmp server,
+// which it receives with its own HTTP listener.
+//
+// If a url is configured, the streams are periodically reconciled
+// with the servers stat xml document, in case callbacks got lost.
+type NginxRtmpPush struct {
+	lock   sync.Mutex
+	config *ServerConfig
+
+	// Used for reconciliation, nil without url.
+	stat          Server
+	lastReconcile time.Time
+
+	listener net.Listener
+
+	// Active streams, mapped to the client id of their publisher (if known).
+	active map[string]string
+
+	// Counts the callbacks that changed active streams, and remembers
+	// for each stream the count of the last one, so that reconcile
+	// keeps what changed while it was waiting for the stat document.
+	generation uint64
+	touched    map[string]uint64
+
+	changed chan struct{}
+}
+
+func NewNginxRtmpPush(config *ServerConfig) Server {
+	np := &NginxRtmpPush{
+		config:  config,
+		active:  make(map[string]string),
+		touched: make(map[string]uint64),
+		changed: make(chan struct{}, 1),
+	}
+	if config.Url != "" {
+		np.stat = NewNginxRtmp(config)
+	}
+	return np
+}
+
+// GetActiveStreams starts the listener, if it isn't running yet,
+// and reconciles if that's due.
+//
+// Failing to reconcile is only logged: the streams known from
+// the callbacks don't depend on the stat document.
+func (np *NginxRtmpPush) GetActiveStreams() (Streams, error) {
+	if err := np.listen(); err != nil {
+		return nil, err
+	}
+	if err := np.reconcile(); err != nil {
+		log.WithError(err).WithField("url", np.config.Url).Warn("Failed to reconcile streams with stat")
+	}
+
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	result := make(Streams)
+	for name := range np.active {
+		result[name] = nil
+	}
+	return result, nil
+}
+
+// Changed receives a value when a callback changed the active streams.
+func (np *NginxRtmpPush) Changed() <-chan struct{} {
+	return np.changed
+}
+
+// Reconfigure keeps the server (and the streams it knows about),
+// unless the listener or the app changed.
+func (np *NginxRtmpPush) Reconfigure(config *ServerConfig) bool {
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	if config.Type != np.config.Type ||
+		config.Listen != np.config.Listen ||
+		config.App != np.config.App {
+		return false
+	}
+
+	np.config = config
+	np.stat = nil
+	if config.Url != "" {
+		np.stat = NewNginxRtmp(config)
+	}
+	return true
+}
+
+func (np *NginxRtmpPush) Close() error {
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	if np.listener == nil {
+		return nil
+	}
+	err := np.listener.Close()
+	np.listener = nil
+	return errors.Trace(err)
+}
+
+// ServeHTTP handles a callback.
+//
+// nginx-rtmp sends the details as form parameters. It only lets a client
+// publish if the reply is successful, so that's what it always gets.
+func (np *NginxRtmpPush) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call, app, name, clientId := r.FormValue("call"), r.FormValue("app"), r.FormValue("name"), r.FormValue("clientid")
+
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	entry := log.WithFields(log.Fields{"call": call, "app": app, "stream": name})
+	if app != np.config.App || name == "" {
+		entry.Debug("Ignoring callback")
+		return
+	}
+
+	switch call {
+	case "publish":
+		entry.Debug("Stream published")
+		np.active[name] = clientId
+		np.touch(name)
+		np.notify()
+
+	// on_done is also called for players, so check that it's the publisher
+	case "publish_done", "done":
+		publisher, ok := np.active[name]
+		if ok && (publisher == "" || clientId == "" || publisher == clientId) {
+			entry.Debug("Stream done")
+			delete(np.active, name)
+			np.touch(name)
+			np.notify()
+		}
+
+	default:
+		entry.Debug("Ignoring callback")
+	}
+}
+
+func (np *NginxRtmpPush) listen() error {
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	if np.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", np.config.Listen)
+	if err != nil {
+		return errors.Annotatef(err, "failed to listen on %s", np.config.Listen)
+	}
+	np.listener = listener
+
+	go func() {
+		err := http.Serve(listener, np)
+
+		np.lock.Lock()
+		defer np.lock.Unlock()
+		if np.listener == listener {
+			log.WithError(err).Error("Callback listener failed")
+			np.listener = nil
+		}
+	}()
+
+	log.WithField("listen", np.config.Listen).Info("Listening for nginx-rtmp callbacks")
+	return nil
+}
+
+// reconcile replaces the active streams with those in the stat xml document,
+// if that's due. Streams that callbacks changed in the meantime are kept as they are.
+func (np *NginxRtmpPush) reconcile() error {
+	np.lock.Lock()
+	stat := np.stat
+	due := stat != nil && time.Since(np.lastReconcile) >= np.config.ReconcileInterval
+	if due {
+		np.lastReconcile = time.Now() // also retry failures only after the interval
+	}
+	generation := np.generation
+	np.lock.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	// Don't hold the lock while waiting for the server
+	streams, err := stat.GetActiveStreams()
+	if err != nil {
+		return err
+	}
+
+	np.lock.Lock()
+	defer np.lock.Unlock()
+
+	added, removed := 0, 0
+	active := make(map[string]string, len(streams))
+	for stream := range streams {
+		if np.touched[stream] > generation {
+			continue
+		}
+		publisher, ok := np.active[stream]
+		if !ok {
+			added++
+		}
+		active[stream] = publisher
+	}
+	for name, publisher := range np.active {
+		if np.touched[name] > generation {
+			active[name] = publisher
+		} else if _, ok := active[name]; !ok {
+			removed++
+		}
+	}
+
+	// The stat document is newer than these callbacks
+	for name, touched := range np.touched {
+		if touched <= generation {
+			delete(np.touched, name)
+		}
+	}
+	if added > 0 || removed > 0 {
+		log.WithFields(log.Fields{
+			"added":   added,
+			"removed": removed,
+		}).Info("Streams reconciled with stat")
+	}
+
+	np.active = active
+	return nil
+}
+
+// Must be called with the lock held.
+func (np *NginxRtmpPush) touch(name string) {
+	np.generation++
+	np.touched[name] = np.generation
+}
+
+// Must be called with the lock held.
+func (np *NginxRtmpPush) notify() {
+	select {
+	case np.changed <- struct{}{}:
+	default:
+	}
+}
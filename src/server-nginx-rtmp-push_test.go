@@ -0,0 +1,131 @@
+package autotee
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deckarep/golang-set"
+	"gopkg.in/yaml.v2"
+)
+
+const nginxRtmpPushTestConfig = `
+server:
+  type: "nginx-rtmp-push"
+  app: "live"
+  listen: "127.0.0.1:0"
+  reconcile_interval: 0
+`
+
+func newNginxRtmpPushForTest(t *testing.T) *NginxRtmpPush {
+	var config Config
+	if err := yaml.Unmarshal([]byte(nginxRtmpPushTestConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+	return config.Servers[0].NewServer(config.Servers[0]).(*NginxRtmpPush)
+}
+
+func nginxCallback(np *NginxRtmpPush, params ...string) {
+	form := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		form.Set(params[i], params[i+1])
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	np.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+type failingServer struct{}
+
+func (failingServer) GetActiveStreams() (Streams, error) {
+	return nil, errors.New("stat unavailable")
+}
+
+// slowServer calls during before returning the streams,
+// like callbacks that arrive while the stat document is being fetched.
+type slowServer struct {
+	streams Streams
+	during  func()
+}
+
+func (ss slowServer) GetActiveStreams() (Streams, error) {
+	ss.during()
+	return ss.streams, nil
+}
+
+func TestNginxRtmpPushCallbacks(t *testing.T) {
+	np := newNginxRtmpPushForTest(t)
+	defer np.Close()
+
+	nginxCallback(np, "call", "publish", "app", "live", "name", "s1", "clientid", "1")
+	nginxCallback(np, "call", "publish", "app", "live", "name", "s2", "clientid", "2")
+	nginxCallback(np, "call", "publish", "app", "other", "name", "s3", "clientid", "3")
+
+	select {
+	case <-np.Changed():
+	default:
+		t.Error("Expected a notification")
+	}
+
+	// A player leaving doesn't end the stream, its publisher does
+	nginxCallback(np, "call", "done", "app", "live", "name", "s1", "clientid", "4")
+	nginxCallback(np, "call", "publish_done", "app", "live", "name", "s2", "clientid", "2")
+
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s1"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+}
+
+func TestNginxRtmpPushReconcile(t *testing.T) {
+	np := newNginxRtmpPushForTest(t)
+	defer np.Close()
+
+	// Pretend that the stat document lists s1 and s3
+	statConfig := &ServerConfig{Streams: mapset.NewSetFromSlice([]interface{}{"s1", "s3"})}
+	np.stat = NewStaticStreamList(statConfig)
+
+	nginxCallback(np, "call", "publish", "app", "live", "name", "s1", "clientid", "1")
+	nginxCallback(np, "call", "publish", "app", "live", "name", "s2", "clientid", "2")
+
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s1", "s3"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+
+	// Without the stat document, the streams from callbacks are kept
+	np.stat = failingServer{}
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s1", "s3"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+	np.stat = NewStaticStreamList(statConfig)
+
+	// The publisher of s1 is still known
+	nginxCallback(np, "call", "done", "app", "live", "name", "s1", "clientid", "4")
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s1", "s3"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+}
+
+func TestNginxRtmpPushReconcileConcurrentCallbacks(t *testing.T) {
+	np := newNginxRtmpPushForTest(t)
+	defer np.Close()
+
+	nginxCallback(np, "call", "publish", "app", "live", "name", "s2", "clientid", "2")
+
+	// Callbacks that arrive while waiting for the stat document are newer than it
+	np.stat = slowServer{Streams{"s2": nil, "s3": nil}, func() {
+		nginxCallback(np, "call", "publish", "app", "live", "name", "s1", "clientid", "1")
+		nginxCallback(np, "call", "publish_done", "app", "live", "name", "s2", "clientid", "2")
+	}}
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s1", "s3"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+
+	// Older callbacks are not, the next stat document wins
+	np.stat = slowServer{Streams{"s2": nil}, func() {}}
+	if streams := activeStreamNames(t, np); !reflect.DeepEqual(streams, []string{"s2"}) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+}
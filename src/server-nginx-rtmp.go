@@ -1,52 +1,150 @@
 package autotee
 
 import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
 	"net/http"
 
-	"github.com/deckarep/golang-set"
 	"github.com/juju/errors"
 	"launchpad.net/xmlpath"
 )
 
-// XPath expression matching the names of active streams in an
-// nginx-rtmp servers stat xml document.
-const defaultXpathStrTemplate = "/rtmp/server/application[name/text()='%s']/live/stream[active]/name/text()"
-
 type NginxRtmp struct {
-	config *Config
+	config *ServerConfig
 	client http.Client
 }
 
-func NewNginxRtmp(config *Config) Server {
+// Part of an nginx-rtmp servers stat xml document.
+type nginxRtmpStat struct {
+	Servers []struct {
+		Applications []struct {
+			Name    string            `xml:"name"`
+			Streams []nginxRtmpStream `xml:"live>stream"`
+		} `xml:"application"`
+	} `xml:"server"`
+}
+
+type nginxRtmpStream struct {
+	Name    string    `xml:"name"`
+	Active  *struct{} `xml:"active"`
+	BwIn    string    `xml:"bw_in"`
+	BwVideo string    `xml:"bw_video"`
+	BwAudio string    `xml:"bw_audio"`
+	Clients []struct {
+		Address    string    `xml:"address"`
+		Publishing *struct{} `xml:"publishing"`
+	} `xml:"client"`
+	Video struct {
+		Width     string `xml:"width"`
+		Height    string `xml:"height"`
+		FrameRate string `xml:"frame_rate"`
+		Codec     string `xml:"codec"`
+	} `xml:"meta>video"`
+	Audio struct {
+		Codec      string `xml:"codec"`
+		SampleRate string `xml:"sample_rate"`
+		Channels   string `xml:"channels"`
+	} `xml:"meta>audio"`
+}
+
+func NewNginxRtmp(config *ServerConfig) Server {
 	return &NginxRtmp{
-		client: http.Client{Timeout: config.Times.ServerRequestTimeout},
+		client: http.Client{Timeout: config.RequestTimeout},
 		config: config,
 	}
 }
 
-// Get a list of active streams of a specific app from an nginx-rtmp server.
-func (nr *NginxRtmp) GetActiveStreams() (mapset.Set, error) {
-	result := mapset.NewSet()
+// Get a list of active streams of a specific app from an nginx-rtmp server,
+// with their metadata.
+//
+// If a custom xpath expression is configured, it selects the stream names.
+func (nr *NginxRtmp) GetActiveStreams() (Streams, error) {
 
 	// Make HTTP request
-	resp, err := nr.client.Get(nr.config.Server.Url)
+	resp, err := nr.client.Get(nr.config.Url)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	defer resp.Body.Close()
 
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	// Parse XML
-	root, err := xmlpath.Parse(resp.Body)
+	streams, err := parseNginxRtmpStat(bytes.NewReader(body), nr.config.App)
+	if err != nil {
+		return nil, err
+	}
+	if nr.config.XPath == nil {
+		return streams, nil
+	}
+
+	root, err := xmlpath.Parse(bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	// Extract stream names
-	iter := nr.config.Server.XPath.Iter(root)
+	result := make(Streams)
+	iter := nr.config.XPath.Iter(root)
 	for iter.Next() {
 		name := iter.Node().String()
-		result.Add(name)
+		result[name] = streams[name]
+	}
+	return result, nil
+}
+
+// parseNginxRtmpStat returns the active streams of an app in a stat xml document.
+func parseNginxRtmpStat(r io.Reader, app string) (Streams, error) {
+	var stat nginxRtmpStat
+	if err := xml.NewDecoder(r).Decode(&stat); err != nil {
+		return nil, errors.Annotate(err, "failed to parse stat document")
 	}
 
+	result := make(Streams)
+	for _, server := range stat.Servers {
+		for _, application := range server.Applications {
+			if application.Name != app {
+				continue
+			}
+			for _, stream := range application.Streams {
+				if stream.Active != nil {
+					result[stream.Name] = stream.metadata()
+				}
+			}
+		}
+	}
 	return result, nil
 }
+
+func (s *nginxRtmpStream) metadata() Metadata {
+	metadata := Metadata{
+		"width":       s.Video.Width,
+		"height":      s.Video.Height,
+		"frame_rate":  s.Video.FrameRate,
+		"vcodec":      s.Video.Codec,
+		"acodec":      s.Audio.Codec,
+		"sample_rate": s.Audio.SampleRate,
+		"channels":    s.Audio.Channels,
+		"bw_in":       s.BwIn,
+		"bw_video":    s.BwVideo,
+		"bw_audio":    s.BwAudio,
+	}
+	for _, client := range s.Clients {
+		if client.Publishing != nil {
+			metadata["client"] = client.Address
+		}
+	}
+
+	// Leave out what nginx-rtmp didn't tell
+	for key, value := range metadata {
+		if value == "" {
+			delete(metadata, key)
+		}
+	}
+	return metadata
+}
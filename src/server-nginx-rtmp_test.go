@@ -0,0 +1,57 @@
+package autotee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNginxRtmp(t *testing.T) {
+	fixture := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/nginx-rtmp-stat.xml")
+	}))
+	defer fixture.Close()
+
+	config := &ServerConfig{
+		Url:            fixture.URL,
+		App:            "stream",
+		RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+	}
+	streams, err := NewNginxRtmp(config).GetActiveStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Streams{
+		"s1_native_hd": Metadata{
+			"width":       "1920",
+			"height":      "1080",
+			"frame_rate":  "25",
+			"vcodec":      "H264",
+			"acodec":      "AAC",
+			"sample_rate": "48000",
+			"channels":    "2",
+			"bw_in":       "5003128",
+			"bw_video":    "4874728",
+			"bw_audio":    "128400",
+			"client":      "192.0.2.10",
+		},
+		"s2_native_sd": Metadata{
+			"width":       "1024",
+			"height":      "576",
+			"frame_rate":  "30",
+			"vcodec":      "H264",
+			"acodec":      "AAC",
+			"sample_rate": "44100",
+			"channels":    "1",
+			"bw_in":       "1544288",
+			"bw_video":    "1448184",
+			"bw_audio":    "96104",
+			"client":      "198.51.100.4",
+		},
+	}
+	if !reflect.DeepEqual(streams, expected) {
+		t.Errorf("Unexpected streams %#v", streams)
+	}
+}
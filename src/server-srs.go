@@ -0,0 +1,114 @@
+package autotee
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// How many streams to ask SRS for at once. It returns only 10 by default.
+const srsPageSize = 100
+
+// Srs gets the active streams from the HTTP API of an SRS server,
+// optionally only those of a specific vhost and app.
+type Srs struct {
+	config *ServerConfig
+	client http.Client
+}
+
+type srsStream struct {
+	Name    string `json:"name"`
+	Vhost   string `json:"vhost"`
+	App     string `json:"app"`
+	Publish struct {
+		Active bool `json:"active"`
+	} `json:"publish"`
+}
+
+type srsVhost struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func NewSrs(config *ServerConfig) Server {
+	return &Srs{
+		config: config,
+		client: http.Client{Timeout: config.RequestTimeout},
+	}
+}
+
+// Get a list of streams that are being published.
+func (s *Srs) GetActiveStreams() (Streams, error) {
+	var vhosts map[string]string
+	if s.config.Vhost != "" {
+		var err error
+		if vhosts, err = s.getVhosts(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(Streams)
+	for start := 0; ; start += srsPageSize {
+		var page struct {
+			Code    int         `json:"code"`
+			Streams []srsStream `json:"streams"`
+		}
+		if err := getJSON(&s.client, s.url(fmt.Sprintf("/api/v1/streams/?start=%d&count=%d", start, srsPageSize)), &page); err != nil {
+			return nil, err
+		}
+		if page.Code != 0 {
+			return nil, errors.Errorf("SRS returned error code %d", page.Code)
+		}
+
+		for _, stream := range page.Streams {
+			if s.matches(stream, vhosts) {
+				result[stream.Name] = nil
+			}
+		}
+
+		if len(page.Streams) < srsPageSize {
+			return result, nil
+		}
+	}
+}
+
+// matches returns whether a stream is active and belongs to the configured vhost and app.
+// Streams refer to their vhost by id, vhosts maps ids to names.
+func (s *Srs) matches(stream srsStream, vhosts map[string]string) bool {
+	if !stream.Publish.Active {
+		return false
+	}
+	if app := s.config.App; app != "" && stream.App != app {
+		return false
+	}
+	if vhost := s.config.Vhost; vhost != "" && stream.Vhost != vhost && vhosts[stream.Vhost] != vhost {
+		return false
+	}
+	return true
+}
+
+// getVhosts returns the names of all vhosts by id.
+func (s *Srs) getVhosts() (map[string]string, error) {
+	var aux struct {
+		Code   int        `json:"code"`
+		Vhosts []srsVhost `json:"vhosts"`
+	}
+	if err := getJSON(&s.client, s.url("/api/v1/vhosts/"), &aux); err != nil {
+		return nil, err
+	}
+	if aux.Code != 0 {
+		return nil, errors.Errorf("SRS returned error code %d", aux.Code)
+	}
+
+	result := make(map[string]string, len(aux.Vhosts))
+	for _, vhost := range aux.Vhosts {
+		result[vhost.Id] = vhost.Name
+	}
+	return result, nil
+}
+
+func (s *Srs) url(path string) string {
+	return strings.TrimRight(s.config.Url, "/") + path
+}
@@ -0,0 +1,49 @@
+package autotee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newSrsTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/streams/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/srs-streams.json")
+	})
+	mux.HandleFunc("/api/v1/vhosts/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/srs-vhosts.json")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSrs(t *testing.T) {
+	fixture := newSrsTestServer()
+	defer fixture.Close()
+
+	tests := []struct {
+		app, vhost string
+		expected   []string
+	}{
+		{"", "", []string{"s1_native_hd", "s3_native_hd", "s4_native_hd"}},
+		{"live", "", []string{"s1_native_hd", "s4_native_hd"}},
+		{"live", "__defaultVhost__", []string{"s1_native_hd"}},
+		{"", "example.com", []string{"s4_native_hd"}},
+		{"", "vid-7y2kq0c", []string{"s4_native_hd"}},
+		{"other", "example.com", []string{}},
+	}
+
+	for _, test := range tests {
+		config := &ServerConfig{
+			Url:            fixture.URL,
+			App:            test.app,
+			Vhost:          test.vhost,
+			RequestTimeout: DefaultTimeConfig.ServerRequestTimeout,
+		}
+		result := activeStreamNames(t, NewSrs(config))
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("app %#v, vhost %#v: expected %#v, got %#v", test.app, test.vhost, test.expected, result)
+		}
+	}
+}
@@ -1,17 +1,13 @@
 package autotee
 
-import (
-	"github.com/deckarep/golang-set"
-)
-
 type StaticStreamList struct {
-	config *Config
+	config *ServerConfig
 }
 
-func NewStaticStreamList(config *Config) Server {
+func NewStaticStreamList(config *ServerConfig) Server {
 	return &StaticStreamList{config}
 }
 
-func (nr *StaticStreamList) GetActiveStreams() (mapset.Set, error) {
-	return nr.config.Server.Streams, nil
+func (nr *StaticStreamList) GetActiveStreams() (Streams, error) {
+	return NewStreams(nr.config.Streams), nil
 }
@@ -0,0 +1,191 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+// Events that change the streams of a watched file. The parent directory
+// is watched, so that files that are replaced by renaming are noticed too.
+const watchFileMask = syscall.IN_CLOSE_WRITE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Events that change the streams of a watched directory.
+const watchDirectoryMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// WatchServer gets the active streams from a file or a directory,
+// and uses inotify to learn about changes right away.
+//
+// For file servers, the file contains one stream name per line.
+// A missing file means that there are no streams.
+//
+// For directory servers, each entry of the directory (like a file or a FIFO)
+// is a stream. Subdirectories and hidden entries are ignored.
+type WatchServer struct {
+	config *ServerConfig
+
+	lock    sync.Mutex
+	watcher *os.File
+
+	changed chan struct{}
+}
+
+func NewWatchServer(config *ServerConfig) Server {
+	return &WatchServer{
+		config:  config,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// GetActiveStreams starts watching, if it isn't yet, and reads the streams.
+func (ws *WatchServer) GetActiveStreams() (Streams, error) {
+	if err := ws.watch(); err != nil {
+		return nil, err
+	}
+
+	if ws.config.Type == "directory" {
+		return ws.readDirectory()
+	}
+	return ws.readFile()
+}
+
+// Changed receives a value when the file or directory changed.
+func (ws *WatchServer) Changed() <-chan struct{} {
+	return ws.changed
+}
+
+func (ws *WatchServer) Close() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.watcher == nil {
+		return nil
+	}
+	err := ws.watcher.Close()
+	ws.watcher = nil
+	return errors.Trace(err)
+}
+
+func (ws *WatchServer) readFile() (Streams, error) {
+	bytes, err := ioutil.ReadFile(ws.config.Path)
+	if os.IsNotExist(err) {
+		return make(Streams), nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return parseStreamList(bytes, "lines")
+}
+
+func (ws *WatchServer) readDirectory() (Streams, error) {
+	infos, err := ioutil.ReadDir(ws.config.Path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	result := make(Streams)
+	for _, info := range infos {
+		if !info.IsDir() && ws.isStream(info.Name()) {
+			result[info.Name()] = nil
+		}
+	}
+	return result, nil
+}
+
+// isStream returns whether a change of the named directory entry
+// can change the streams.
+func (ws *WatchServer) isStream(name string) bool {
+	if ws.config.Type == "directory" {
+		return !strings.HasPrefix(name, ".")
+	}
+	return name == filepath.Base(ws.config.Path)
+}
+
+func (ws *WatchServer) watch() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.watcher != nil {
+		return nil
+	}
+
+	path, mask := filepath.Dir(ws.config.Path), uint32(watchFileMask)
+	if ws.config.Type == "directory" {
+		path, mask = ws.config.Path, watchDirectoryMask
+	}
+
+	// Non-blocking, so that closing the file interrupts a read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return errors.Annotate(os.NewSyscallError("inotify_init1", err), "failed to start watching")
+	}
+	if _, err := syscall.InotifyAddWatch(fd, path, mask); err != nil {
+		syscall.Close(fd)
+		return errors.Annotatef(os.NewSyscallError("inotify_add_watch", err), "failed to watch %s", path)
+	}
+
+	ws.watcher = os.NewFile(uintptr(fd), "inotify")
+	go ws.run(ws.watcher)
+	return nil
+}
+
+func (ws *WatchServer) run(watcher *os.File) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := watcher.Read(buf)
+		if err != nil {
+			ws.forget(watcher)
+			return
+		}
+
+		changed, gone := false, false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[offset:offset+int(event.Len)]), "\x00")
+			offset += int(event.Len)
+
+			// Too many events => some were lost
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 || ws.isStream(name) {
+				changed = true
+			}
+
+			// Watched directory was removed
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				gone = true
+			}
+		}
+
+		if gone {
+			// Start over with the next GetActiveStreams, which also reports the error
+			ws.forget(watcher)
+			changed = true
+		}
+		if changed {
+			select {
+			case ws.changed <- struct{}{}:
+			default:
+			}
+		}
+		if gone {
+			return
+		}
+	}
+}
+
+// forget closes the watcher, unless it was already replaced or closed.
+func (ws *WatchServer) forget(watcher *os.File) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.watcher == watcher {
+		watcher.Close()
+		ws.watcher = nil
+	}
+}
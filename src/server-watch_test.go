@@ -0,0 +1,95 @@
+package autotee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitForChange(t *testing.T, ws *WatchServer) {
+	select {
+	case <-ws.Changed():
+	case <-time.After(2 * time.Second):
+		t.Fatal("No change noticed")
+	}
+}
+
+func TestWatchDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autotee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ws := NewWatchServer(&ServerConfig{Type: "directory", Path: dir}).(*WatchServer)
+	defer ws.Close()
+
+	if streams := activeStreamNames(t, ws); len(streams) != 0 {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "s1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "s2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t, ws)
+	if streams := activeStreamNames(t, ws); !reflect.DeepEqual(streams, []string{"s1", "s2"}) {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "s1")); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t, ws)
+	if streams := activeStreamNames(t, ws); !reflect.DeepEqual(streams, []string{"s2"}) {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autotee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "streams")
+
+	ws := NewWatchServer(&ServerConfig{Type: "file", Path: path}).(*WatchServer)
+	defer ws.Close()
+
+	if streams := activeStreamNames(t, ws); len(streams) != 0 {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("s1\ns2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t, ws)
+	if streams := activeStreamNames(t, ws); !reflect.DeepEqual(streams, []string{"s1", "s2"}) {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+
+	// Replaced by renaming
+	if err := ioutil.WriteFile(path+".new", []byte("s3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".new", path); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t, ws)
+	if streams := activeStreamNames(t, ws); !reflect.DeepEqual(streams, []string{"s3"}) {
+		t.Fatalf("Unexpected streams %#v", streams)
+	}
+}
@@ -1,11 +1,112 @@
 package autotee
 
 import (
+	"encoding/json"
+	"net/http"
+
 	"github.com/deckarep/golang-set"
+	"github.com/juju/errors"
 )
 
 type Server interface {
-	GetActiveStreams() (mapset.Set, error)
+	GetActiveStreams() (Streams, error)
+}
+
+// Metadata describes a stream, like {"width": "1920", "height": "1080"}.
+// The keys are in MetadataFields. Servers leave out what they don't know.
+type Metadata map[string]string
+
+// Streams maps the names of active streams to their metadata, which may be nil.
+type Streams map[string]Metadata
+
+// MetadataFields are the names of the metadata fields servers can provide.
+// Flows can use them as variables, like "{width}".
+var MetadataFields = []string{
+	"width",      // video width in pixels
+	"height",     // video height in pixels
+	"frame_rate", // video frames per second
+	"vcodec",     // video codec, like "H264"
+	"acodec",     // audio codec, like "AAC"
+	"sample_rate",
+	"channels",
+	"bw_in",    // incoming bits per second
+	"bw_video", // incoming video bits per second
+	"bw_audio", // incoming audio bits per second
+	"client",   // address of the publisher
+
+	"bitrate",      // nominal bitrate, as announced by the source
+	"listeners",    // number of listeners
+	"content_type", // like "audio/mpeg"
+}
+
+// Diff returns those of the given fields whose values differ.
+//
+// Fields that one side doesn't know are left out: servers briefly
+// don't know the metadata of a stream, like when the encoder reconnects.
+func (m Metadata) Diff(other Metadata, fields []string) []string {
+	var result []string
+	for _, field := range fields {
+		if m[field] != "" && other[field] != "" && m[field] != other[field] {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// Equals returns whether both have the same fields with the same values.
+func (m Metadata) Equals(other Metadata) bool {
+	if len(m) != len(other) {
+		return false
+	}
+	for field, value := range m {
+		if otherValue, ok := other[field]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
 }
 
-type ServerFactory func(config *Config) Server
+// NewStreams returns streams without metadata.
+func NewStreams(names mapset.Set) Streams {
+	result := make(Streams, names.Cardinality())
+	for name := range names.Iter() {
+		result[name.(string)] = nil
+	}
+	return result
+}
+
+type ServerFactory func(config *ServerConfig) Server
+
+// Notifier is implemented by servers that learn about changes by themselves.
+// Changed() receives a value when the active streams may have changed,
+// so they can be fetched right away instead of at the next poll.
+type Notifier interface {
+	Changed() <-chan struct{}
+}
+
+// Reconfigurable is implemented by servers that keep state, like the streams
+// they were told about. Reconfigure applies a new configuration. It returns
+// false if it can't, and the server needs to be replaced.
+//
+// Servers that implement io.Closer are closed when they are replaced.
+type Reconfigurable interface {
+	Reconfigure(config *ServerConfig) bool
+}
+
+// getJSON fetches a JSON document from the API of a server.
+func getJSON(client *http.Client, url string, result interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Annotatef(err, "failed to parse response from %s", url)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package autotee
+
+import (
+	"sort"
+	"testing"
+)
+
+// activeStreamNames returns the sorted names of the active streams of a server.
+func activeStreamNames(t *testing.T, server Server) []string {
+	streams, err := server.GetActiveStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]string, 0, len(streams))
+	for stream := range streams {
+		result = append(result, stream)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -7,22 +7,32 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 	"github.com/pwaller/barrier"
+	"github.com/rcrowley/go-metrics"
 	"golang.org/x/net/context"
 )
 
 type Sink struct {
-	ctx context.Context
-	log *log.Entry
+	ctx     context.Context
+	log     *log.Entry
+	metrics *SinkMetrics
 
 	command CmdData
 
 	screen *Screen
 
+	// Receives a copy of everything written to the screen.
+	stderr *LineRing
+
+	hooks ProcessHooks
+
 	c chan *BufPoolElem
 
 	cmd   *Cmd
 	stdin io.Writer
 
+	// Result of waiting for the process. Set when all goroutines are exiting.
+	exitErr error
+
 	// Falls when the process dies.
 	deathBarrier barrier.Barrier
 
@@ -32,17 +42,53 @@ type Sink struct {
 	cancel context.CancelFunc
 }
 
-func NewSink(ctx context.Context, entry *log.Entry, name string, command CmdData, config *BufferConfig, screen *Screen) *Sink {
+// SinkMetrics count what happens to the processes of one sink.
+//
+// They are shared by all processes started for the sink, so they
+// continue counting across restarts.
+type SinkMetrics struct {
+	BytesWritten     metrics.Counter
+	BuffersDelivered metrics.Counter
+	Stalls           metrics.Counter
+	Restarts         metrics.Counter
+	StartFailures    metrics.Counter
+	QueueDepth       metrics.Gauge
+	GivenUp          metrics.Gauge
+}
+
+func NewSinkMetrics(labels MetricLabels) *SinkMetrics {
+	counter := func(name string) metrics.Counter {
+		return metrics.GetOrRegister(labels.Name(name), metrics.NewCounter()).(metrics.Counter)
+	}
+	gauge := func(name string) metrics.Gauge {
+		return metrics.GetOrRegister(labels.Name(name), metrics.NewGauge()).(metrics.Gauge)
+	}
+
+	return &SinkMetrics{
+		BytesWritten:     counter("sink.bytes_written"),
+		BuffersDelivered: counter("sink.buffers_delivered"),
+		Stalls:           counter("sink.stalls"),
+		Restarts:         counter("sink.restarts"),
+		StartFailures:    counter("sink.start_failures"),
+		QueueDepth:       gauge("sink.queue_depth"),
+		GivenUp:          gauge("sink.given_up"),
+	}
+}
+
+func NewSink(ctx context.Context, entry *log.Entry, name string, command CmdData, config *BufferConfig, screen *Screen, stderr *LineRing, hooks ProcessHooks, sinkMetrics *SinkMetrics) *Sink {
 	sinkCtx, cancel := context.WithCancel(ctx)
 
 	return &Sink{
-		ctx: sinkCtx,
+		ctx:     sinkCtx,
+		metrics: sinkMetrics,
 
 		log: entry.WithFields(log.Fields{"sink": name}),
 
 		command: command,
 
 		screen: screen,
+		stderr: stderr,
+		hooks:  hooks,
 
 		c: make(chan *BufPoolElem, config.BufferCount),
 
@@ -63,7 +109,9 @@ func (s *Sink) Start() (err error) {
 	if err != nil {
 		return errors.Annotate(err, "Failed to create pipe")
 	}
-	s.cmd.SetStderr(s.screen.File)
+	if err = s.cmd.TeeStderr(stderrOutput(s.screen, s.log), s.stderr); err != nil {
+		return errors.Annotate(err, "Failed to create pipe")
+	}
 	err = s.cmd.Start()
 	if err != nil {
 		return errors.Annotate(err, "Failed to start process")
@@ -72,14 +120,20 @@ func (s *Sink) Start() (err error) {
 	// Begin reading
 	s.goRun()
 
-	s.log.WithFields(log.Fields{
-		"screen": s.screen.Name,
-		"pid":    s.cmd.Pid(),
-	}).Info("Sink started")
+	fields := log.Fields{"pid": s.cmd.Pid()}
+	if s.screen != nil {
+		fields["screen"] = s.screen.Name
+	}
+	s.log.WithFields(fields).Info("Sink started")
 
 	return nil
 }
 
+// Returns the number of buffers queued for the process and the queue size.
+func (s *Sink) Buffers() (fill, size int) {
+	return len(s.c), cap(s.c)
+}
+
 func (s *Sink) Channel() chan<- *BufPoolElem {
 	return s.c
 }
@@ -89,6 +143,17 @@ func (s *Sink) Kill() {
 	s.cancel()
 }
 
+func (s *Sink) Pid() int {
+	return s.cmd.Pid()
+}
+
+// ExitError returns the result of waiting for the process.
+//
+// Must only be called after Stop().
+func (s *Sink) ExitError() error {
+	return s.exitErr
+}
+
 func (s *Sink) DeathBarrier() <-chan struct{} {
 	return s.deathBarrier.Barrier()
 }
@@ -103,7 +168,6 @@ func (s *Sink) goRun() {
 	s.quitWait.Add(1)
 	go func() {
 		defer s.quitWait.Done()
-		defer s.log.Debug("Sink stopped")
 
 		// Make Write() interruptible
 		killOnce := sync.Once{}
@@ -116,6 +180,7 @@ func (s *Sink) goRun() {
 		}()
 
 		// Process alive
+		failed := false
 		for running := true; running; {
 			select {
 			case buf, more := <-s.c:
@@ -123,11 +188,16 @@ func (s *Sink) goRun() {
 					panic("Channel closed by wrong goroutine")
 				}
 
-				_, err := s.stdin.Write(buf.GetBuffer())
+				n, err := s.stdin.Write(buf.GetBuffer())
 				buf.Free()
+				s.metrics.BytesWritten.Inc(int64(n))
+				s.metrics.QueueDepth.Update(int64(len(s.c)))
 				if err != nil {
 					s.log.WithError(err).Debug("Write failed")
 					running = false
+					failed = s.ctx.Err() == nil
+				} else {
+					s.metrics.BuffersDelivered.Inc(1)
 				}
 
 			case <-s.ctx.Done():
@@ -153,10 +223,22 @@ func (s *Sink) goRun() {
 
 		// Stop() was called
 		killOnce.Do(func() { s.cmd.KillGroup() })
-		<-s.cmd.WaitChannel()
+		s.exitErr = <-s.cmd.WaitChannel()
 		close(s.c)
 		for buf := range s.c {
 			buf.Free()
 		}
+
+		// Show why it died, unless it was killed or stopped
+		if failed {
+			details := map[string]interface{}{
+				"exit":   describeExit(s.exitErr),
+				"stderr": stderrTail(s.stderr),
+			}
+			s.log.WithFields(log.Fields(details)).Info("Sink stopped")
+			s.hooks.Send(EventSinkDied, details)
+		} else {
+			s.log.Debug("Sink stopped")
+		}
 	}()
 }
@@ -12,14 +12,15 @@ import (
 
 // SinkSet starts and supervises multiple sinks.
 type SinkSet struct {
-	ctx context.Context
-	log *log.Entry
+	ctx    context.Context
+	log    *log.Entry
+	labels MetricLabels
 
 	commands map[string]SinkCmdData
 
 	c <-chan *BufPoolElem
 
-	config *Config
+	config *FlowConfig
 
 	addSink    chan *Sink // blocking
 	removeSink chan *Sink // blocking
@@ -36,14 +37,18 @@ type SinkSet struct {
 type SinkCmdData struct {
 	Screens ScreenService
 	Command CmdData
+	State   *ProcessState
+	Backoff *Backoff
+	Hooks   ProcessHooks
 }
 
-func NewSinkSet(ctx context.Context, commands map[string]SinkCmdData, buffers <-chan *BufPoolElem, config *Config, entry *log.Entry) *SinkSet {
+func NewSinkSet(ctx context.Context, commands map[string]SinkCmdData, buffers <-chan *BufPoolElem, config *FlowConfig, entry *log.Entry, labels MetricLabels) *SinkSet {
 	sinkSetCtx, cancel := context.WithCancel(ctx)
 
 	return &SinkSet{
-		ctx: sinkSetCtx,
-		log: entry,
+		ctx:    sinkSetCtx,
+		log:    entry,
+		labels: labels,
 
 		commands: commands,
 
@@ -86,37 +91,62 @@ func (ss *SinkSet) goStartSink(name string, command SinkCmdData) {
 	go func() {
 		defer ss.quitWait.Done()
 
+		sinkMetrics := NewSinkMetrics(ss.labels.With("sink", name))
+
+		gaveUp := func() {
+			ss.log.WithFields(log.Fields{
+				"sink":     name,
+				"failures": ss.config.Misc.GiveUpFailures,
+			}).Error("Sink keeps failing, giving up")
+			sinkMetrics.GivenUp.Update(1)
+		}
+
+		// Waits before the next attempt. Returns false if the SinkSet is stopping.
+		waitBeforeRestart := func(uptime time.Duration, killed bool) bool {
+			return command.Backoff.WaitBeforeRestart(ss.ctx, uptime, killed, command.State, command.Hooks, gaveUp)
+		}
+
 		for {
 
-			// Get a screen for the new process
+			// Disabled at runtime, or given up?
+			if !command.State.WaitEnabled(ss.ctx) {
+				return
+			}
+			sinkMetrics.GivenUp.Update(0)
+
+			// Get a screen for the new process (nil in headless mode)
 			screen, err := command.Screens.Screen()
 			if err != nil {
 				ss.log.WithError(err).Warn("Failed to start screen")
 
 				// Wait before trying again
-				select {
-				case <-time.After(ss.config.Times.SinkRestartDelay):
+				if waitBeforeRestart(0, false) {
 					continue
-				case <-ss.ctx.Done():
-					return
 				}
+				return
 			}
 
-			s := NewSink(ss.ctx, ss.log, name, command.Command, &ss.config.SinkBuffer, screen)
+			s := NewSink(ss.ctx, ss.log, name, command.Command, &ss.config.SinkBuffer, screen, command.State.Stderr(), command.Hooks, sinkMetrics)
 
 			// Try to start process
 			if err := s.Start(); err != nil {
 				s.log.WithError(err).Warn("Sink failed to start")
+				sinkMetrics.StartFailures.Inc(1)
+				command.State.Exited(err)
 				command.Screens.Done()
 
 				// Wait before trying again
-				select {
-				case <-time.After(ss.config.Times.SinkRestartDelay):
+				if waitBeforeRestart(0, false) {
 					continue
-				case <-ss.ctx.Done():
-					return
 				}
+				return
+			}
+
+			// Counted by the state, which outlives the SinkSet (restarted with the source)
+			if command.State.Started(s, screen.GetName()) {
+				sinkMetrics.Restarts.Inc(1)
 			}
+			startedAt := time.Now()
 
 			// Give it to goRun
 			select {
@@ -130,7 +160,11 @@ func (ss *SinkSet) goStartSink(name string, command SinkCmdData) {
 			case <-ss.ctx.Done():
 			}
 
-			ss.anySinkDied.Fall()
+			// Restarting or disabling a sink on request doesn't count as dying
+			killed := command.State.Killed()
+			if !killed {
+				ss.anySinkDied.Fall()
+			}
 
 			// Take it back
 			select {
@@ -140,14 +174,12 @@ func (ss *SinkSet) goStartSink(name string, command SinkCmdData) {
 
 			// Wait till its really dead
 			s.Stop()
-
+			uptime := time.Since(startedAt)
+			command.State.Exited(s.ExitError())
 			command.Screens.Done()
 
 			// Wait before respawning
-			select {
-			case <-time.After(ss.config.Times.SinkRestartDelay):
-				continue
-			case <-ss.ctx.Done():
+			if !waitBeforeRestart(uptime, killed) {
 				return
 			}
 		}
@@ -191,10 +223,13 @@ func (ss *SinkSet) goRun() {
 
 					// Send to sink
 					case sink.Channel() <- buf:
+						sink.metrics.QueueDepth.Update(int64(len(sink.c)))
 
 					// Sink stalling?
 					default:
 						sink.log.Warn("Sink stalled")
+						sink.metrics.Stalls.Inc(1)
+						sink.hooks.Send(EventSinkStalled, map[string]interface{}{"queue_size": cap(sink.c)})
 						buf.Free() // the sinks ref
 						sinks.Remove(sink)
 						sink.Kill()
@@ -1,7 +1,6 @@
 package autotee
 
 import (
-	"fmt"
 	"io"
 	"sync"
 
@@ -15,13 +14,18 @@ import (
 type Source struct {
 	ctx context.Context
 
-	log  *log.Entry
-	name string
+	log    *log.Entry
+	labels MetricLabels
 
 	command CmdData
 
 	screen *Screen
 
+	// Receives a copy of everything written to the screen.
+	stderr *LineRing
+
+	hooks ProcessHooks
+
 	c chan *BufPoolElem
 
 	bufpool *BufPool
@@ -29,6 +33,9 @@ type Source struct {
 	cmd    *Cmd
 	stdout io.Reader
 
+	// Result of waiting for the process. Set when all goroutines are exiting.
+	exitErr error
+
 	// Falls when the process dies.
 	deathBarrier barrier.Barrier
 
@@ -38,17 +45,19 @@ type Source struct {
 	cancel context.CancelFunc
 }
 
-func NewSource(ctx context.Context, name string, command CmdData, config *Config, entry *log.Entry, bufpool *BufPool, screen *Screen) *Source {
+func NewSource(ctx context.Context, labels MetricLabels, command CmdData, config *FlowConfig, entry *log.Entry, bufpool *BufPool, screen *Screen, stderr *LineRing, hooks ProcessHooks) *Source {
 	srcCtx, cancel := context.WithCancel(ctx)
 
 	return &Source{
 		ctx: srcCtx,
 
-		log:  entry,
-		name: name,
+		log:    entry,
+		labels: labels,
 
 		command: command,
 		screen:  screen,
+		stderr:  stderr,
+		hooks:   hooks,
 
 		c: make(chan *BufPoolElem),
 
@@ -70,7 +79,10 @@ func (s *Source) Start() (err error) {
 		s.log.WithError(err).Info("Failed to create pipe")
 		return errors.Trace(err)
 	}
-	s.cmd.SetStderr(s.screen.File)
+	if err = s.cmd.TeeStderr(stderrOutput(s.screen, s.log), s.stderr); err != nil {
+		s.log.WithError(err).Info("Failed to create pipe")
+		return errors.Trace(err)
+	}
 	err = s.cmd.Start()
 	if err != nil {
 		s.log.WithError(err).Info("Failed to start process")
@@ -80,13 +92,19 @@ func (s *Source) Start() (err error) {
 	// Begin reading
 	s.goRun()
 
-	s.log.WithFields(log.Fields{
-		"screen": s.screen.Name,
-		"pid":    s.cmd.Pid(),
-	}).Info("Source started")
+	fields := log.Fields{"pid": s.cmd.Pid()}
+	if s.screen != nil {
+		fields["screen"] = s.screen.Name
+	}
+	s.log.WithFields(fields).Info("Source started")
 	return nil
 }
 
+// Returns the number of buffers of the pool currently in use and the pool size.
+func (s *Source) Buffers() (fill, size int) {
+	return s.bufpool.Usage()
+}
+
 func (s *Source) Channel() <-chan *BufPoolElem {
 	return s.c
 }
@@ -96,6 +114,17 @@ func (s *Source) Kill() {
 	s.cancel()
 }
 
+func (s *Source) Pid() int {
+	return s.cmd.Pid()
+}
+
+// ExitError returns the result of waiting for the process.
+//
+// Must only be called after Stop().
+func (s *Source) ExitError() error {
+	return s.exitErr
+}
+
 func (s *Source) DeathBarrier() <-chan struct{} {
 	return s.deathBarrier.Barrier()
 }
@@ -112,7 +141,7 @@ func (s *Source) goRun() {
 		defer s.quitWait.Done()
 		defer s.log.Debug("Source stopped")
 
-		throughputMetric := metrics.GetOrRegister(fmt.Sprintf("sink.%s.throughput", s.name), metrics.NewMeter()).(metrics.Meter)
+		throughputMetric := metrics.GetOrRegister(s.labels.Name("source.throughput"), metrics.NewMeter()).(metrics.Meter)
 
 		// Make Read() interruptible
 		killOnce := sync.Once{}
@@ -125,6 +154,7 @@ func (s *Source) goRun() {
 		}()
 
 		// Process alive
+		failed := false
 		for running := true; running; {
 
 			// Get a buffer
@@ -138,6 +168,7 @@ func (s *Source) goRun() {
 			default:
 				s.log.Error("Source out of buffer space")
 				running = false
+				failed = true
 				continue
 			}
 
@@ -164,10 +195,19 @@ func (s *Source) goRun() {
 			if err == io.EOF || err != nil {
 				s.log.WithError(err).Debug("Read failed")
 				running = false
+				failed = s.ctx.Err() == nil
 				continue
 			}
 		}
-		s.log.Debug("Source dying")
+
+		// Show why it died, unless it was killed or stopped
+		if failed {
+			tail := stderrTail(s.stderr)
+			s.log.WithField("stderr", tail).Info("Source dying")
+			s.hooks.Send(EventSourceDied, map[string]interface{}{"stderr": tail})
+		} else {
+			s.log.Debug("Source dying")
+		}
 		s.deathBarrier.Fall()
 
 		// Process dead, wait for Stop()
@@ -186,7 +226,7 @@ func (s *Source) goRun() {
 
 		// Stop() was called
 		killOnce.Do(func() { s.cmd.KillGroup() })
-		<-s.cmd.WaitChannel()
+		s.exitErr = <-s.cmd.WaitChannel()
 		close(s.c)
 		for buf := range s.c {
 			buf.Free()
@@ -0,0 +1,257 @@
+package autotee
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"golang.org/x/net/context"
+)
+
+// Process is a running source or sink process.
+type Process interface {
+	Pid() int
+
+	// Returns how many buffers are in use and how many there are.
+	Buffers() (fill, size int)
+
+	// Doesn't block.
+	Kill()
+}
+
+// ProcessStatus describes a supervised process, see ProcessState.
+type ProcessStatus struct {
+	Running    bool      `json:"running"`
+	Disabled   bool      `json:"disabled"`
+	GaveUp     bool      `json:"gave_up"`
+	Pid        int       `json:"pid,omitempty"`
+	Screen     string    `json:"screen,omitempty"`
+	Started    time.Time `json:"started"`
+	Uptime     float64   `json:"uptime"`
+	Restarts   int       `json:"restarts"`
+	LastExit   string    `json:"last_exit,omitempty"`
+	BufferFill int       `json:"buffer_fill"`
+	BufferSize int       `json:"buffer_size"`
+}
+
+// ProcessState tracks and controls a supervised process across restarts.
+//
+// Fully thread-safe.
+type ProcessState struct {
+	lock    sync.Mutex
+	status  ProcessStatus
+	process Process
+
+	// Recent stderr output of the processes. Never nil if created by NewProcessState.
+	stderr *LineRing
+
+	// Set when the process was killed by Restart() or Disable().
+	killed bool
+
+	// Closed when a disabled (or given up) process is enabled again.
+	enabled chan struct{}
+}
+
+// FlowStatus describes a flow and its processes.
+type FlowStatus struct {
+	Server string                   `json:"server,omitempty"`
+	Stream string                   `json:"stream"`
+	Flow   string                   `json:"flow"`
+	Source ProcessStatus            `json:"source"`
+	Sinks  map[string]ProcessStatus `json:"sinks"`
+}
+
+// NewProcessState returns a ProcessState that keeps the last stderrLines
+// lines of stderr output.
+func NewProcessState(stderrLines int) *ProcessState {
+	return &ProcessState{
+		stderr: NewLineRing(stderrLines),
+	}
+}
+
+// Stderr returns the recent stderr output of the processes.
+// Processes should write their stderr to it.
+func (ps *ProcessState) Stderr() *LineRing {
+	return ps.stderr
+}
+
+// Started records that a new process has been started,
+// and returns whether it is a restart (as opposed to the first start).
+func (ps *ProcessState) Started(process Process, screen string) (restarted bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	restarted = !ps.status.Started.IsZero()
+	if restarted {
+		ps.status.Restarts++
+	}
+	ps.status.Running = true
+	ps.status.Pid = process.Pid()
+	ps.status.Screen = screen
+	ps.status.Started = time.Now()
+	ps.process = process
+	ps.killed = false
+
+	// Disabled while it was being started?
+	if ps.blocked() {
+		ps.kill()
+	}
+	return
+}
+
+// Exited records that the process has ended (or failed to start).
+//
+// Takes the error returned from Wait() or Start().
+func (ps *ProcessState) Exited(err error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.status.Running = false
+	ps.status.LastExit = describeExit(err)
+	ps.process = nil
+	ps.killed = false
+}
+
+// Killed reports whether the current process was killed by Restart() or Disable(),
+// as opposed to dying on its own or being stopped by its supervisor.
+func (ps *ProcessState) Killed() bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	return ps.killed
+}
+
+func (ps *ProcessState) Status() ProcessStatus {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	status := ps.status
+	if status.Running {
+		status.Uptime = time.Since(status.Started).Seconds()
+	}
+	if ps.process != nil {
+		status.BufferFill, status.BufferSize = ps.process.Buffers()
+	}
+	return status
+}
+
+// Restart kills the current process, if there is one.
+// Its supervisor will then start a new one,
+// even if it had given up on the process.
+//
+// Doesn't block.
+func (ps *ProcessState) Restart() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.status.GaveUp {
+		ps.status.GaveUp = false
+		ps.unblock()
+	}
+	ps.kill()
+}
+
+// Disable kills the current process, if there is one,
+// and keeps its supervisor from starting a new one until Enable() is called.
+//
+// Idempotent.
+// Doesn't block.
+func (ps *ProcessState) Disable() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.block()
+	ps.status.Disabled = true
+	ps.kill()
+}
+
+// GiveUp is called by the supervisor when the process keeps failing.
+// Like Disable(), it keeps the supervisor from starting a new process
+// until Enable() or Restart() is called.
+//
+// Doesn't block.
+func (ps *ProcessState) GiveUp() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.block()
+	ps.status.GaveUp = true
+}
+
+// Enable allows the supervisor to start processes again.
+//
+// Idempotent.
+// Doesn't block.
+func (ps *ProcessState) Enable() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.status.Disabled = false
+	ps.status.GaveUp = false
+	ps.unblock()
+}
+
+// WaitEnabled blocks while the process is disabled.
+//
+// Returns false if the context was canceled first.
+func (ps *ProcessState) WaitEnabled(ctx context.Context) bool {
+	ps.lock.Lock()
+	enabled := ps.enabled
+	blocked := ps.blocked()
+	ps.lock.Unlock()
+
+	if !blocked {
+		return true
+	}
+
+	select {
+	case <-enabled:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// The following methods must be called with the lock held.
+
+func (ps *ProcessState) blocked() bool {
+	return ps.status.Disabled || ps.status.GaveUp
+}
+
+func (ps *ProcessState) block() {
+	if !ps.blocked() {
+		ps.enabled = make(chan struct{})
+	}
+}
+
+func (ps *ProcessState) unblock() {
+	if !ps.blocked() && ps.enabled != nil {
+		close(ps.enabled)
+		ps.enabled = nil
+	}
+}
+
+func (ps *ProcessState) kill() {
+	if ps.process != nil {
+		ps.killed = true
+		ps.process.Kill()
+	}
+}
+
+// How many lines of stderr output to include in log entries.
+const stderrLogLines = 20
+
+// stderrTail returns the last lines of stderr output for a log entry.
+func stderrTail(stderr *LineRing) string {
+	return strings.Join(stderr.Tail(stderrLogLines), "\n")
+}
+
+// describeExit takes an error returned from Wait() and describes it like
+// "exit status 1" or "signal: killed".
+func describeExit(errFromWait error) string {
+	if errFromWait == nil {
+		return "exit status 0"
+	}
+	return errors.Cause(errFromWait).Error()
+}
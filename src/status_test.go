@@ -0,0 +1,63 @@
+package autotee
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type fakeProcess struct {
+	killed int
+}
+
+func (fp *fakeProcess) Pid() int                  { return 42 }
+func (fp *fakeProcess) Buffers() (fill, size int) { return 1, 8 }
+func (fp *fakeProcess) Kill()                     { fp.killed++ }
+
+func TestProcessStateDisable(t *testing.T) {
+	var ps ProcessState
+	process := &fakeProcess{}
+
+	if ps.Started(process, "screen") {
+		t.Fatal("The first Started() should not be a restart")
+	}
+	if status := ps.Status(); !status.Running || status.Pid != 42 || status.BufferFill != 1 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	// Disabling kills the process.
+	ps.Disable()
+	if process.killed != 1 || !ps.Killed() {
+		t.Fatal("Disable() should have killed the process")
+	}
+	ps.Exited(nil)
+	if status := ps.Status(); status.Running || !status.Disabled || status.LastExit != "exit status 0" {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	// While disabled, the supervisor has to wait.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if ps.WaitEnabled(ctx) {
+		t.Fatal("WaitEnabled() should have timed out")
+	}
+
+	// Enabling lets it continue.
+	waited := make(chan bool)
+	go func() {
+		waited <- ps.WaitEnabled(context.Background())
+	}()
+	ps.Enable()
+	if !<-waited {
+		t.Fatal("WaitEnabled() should have returned true")
+	}
+
+	// Restarts are counted.
+	if !ps.Started(process, "screen") {
+		t.Fatal("Started() should have reported a restart")
+	}
+	if status := ps.Status(); status.Restarts != 1 || status.Disabled {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,140 @@
+package autotee
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Backoff computes how long to wait before restarting a process that died.
+//
+// Delays start at the base delay and double with every failure, up to the
+// maximum delay. Once a process has run for the healthy time, the next delay
+// starts over at the base delay. Each delay is randomly shortened by up to
+// the jitter (a fraction between 0 and 1).
+//
+// If giveUp is >0, Failed reports when there have been that many failures
+// within the window, so the supervisor can stop restarting the process.
+//
+// If restartLoop is >0, a process counts as being in a restart loop once it
+// failed that many times in a row, without running for the healthy time.
+//
+// Not thread-safe.
+type Backoff struct {
+	base, max    time.Duration
+	healthy      time.Duration
+	jitter       float64
+	giveUp       int
+	giveUpWindow time.Duration
+	restartLoop  int
+
+	delay          time.Duration
+	recentFailures []time.Time
+	failures       int
+
+	// Set by Failed when the failures reached restartLoop.
+	enteredRestartLoop bool
+}
+
+func NewBackoff(base time.Duration, times *TimeConfig, misc *MiscConfig) *Backoff {
+	return &Backoff{
+		base:         base,
+		max:          times.RestartMaxDelay,
+		healthy:      times.RestartHealthyTime,
+		jitter:       float64(misc.RestartJitter) / 100,
+		giveUp:       misc.GiveUpFailures,
+		giveUpWindow: times.GiveUpWindow,
+		restartLoop:  misc.RestartLoopFailures,
+	}
+}
+
+// Failures returns how many times in a row the process failed,
+// without running for the healthy time in between.
+func (b *Backoff) Failures() int {
+	return b.failures
+}
+
+// EnteredRestartLoop reports whether the last failure made the process
+// count as being in a restart loop.
+func (b *Backoff) EnteredRestartLoop() bool {
+	return b.enteredRestartLoop
+}
+
+// Failed records that a process died (or couldn't be started) after
+// running for `uptime`.
+//
+// Returns how long to wait before starting it again,
+// or true if the supervisor should give up.
+func (b *Backoff) Failed(uptime time.Duration) (time.Duration, bool) {
+	now := time.Now()
+
+	// Was healthy for a while? Start over.
+	if uptime >= b.healthy {
+		b.delay = 0
+		b.recentFailures = nil
+		b.failures = 0
+	}
+	previous := b.failures
+	b.failures++
+	b.enteredRestartLoop = b.restartLoop > 0 && previous < b.restartLoop && b.failures >= b.restartLoop
+
+	if b.delay == 0 || b.max <= b.base {
+		b.delay = b.base
+	} else if b.delay *= 2; b.delay > b.max {
+		b.delay = b.max
+	}
+
+	if b.giveUp > 0 {
+		recent := make([]time.Time, 0, len(b.recentFailures)+1)
+		for _, t := range b.recentFailures {
+			if now.Sub(t) < b.giveUpWindow {
+				recent = append(recent, t)
+			}
+		}
+		b.recentFailures = append(recent, now)
+
+		if len(b.recentFailures) >= b.giveUp {
+			b.delay = 0
+			b.recentFailures = nil
+			return 0, true
+		}
+	}
+
+	return b.delay - time.Duration(rand.Float64()*b.jitter*float64(b.delay)), false
+}
+
+// WaitBeforeRestart records that a supervised process ended (or couldn't be
+// started) after running for `uptime`, and waits before it is started again.
+//
+// Processes killed by Restart() or Disable() don't count as failures and
+// are started again after the base delay. When the supervisor should give up,
+// the state is marked as given up and gaveUp is called, so the next
+// ProcessState.WaitEnabled blocks until the process is enabled again.
+//
+// Returns false if the context is done.
+func (b *Backoff) WaitBeforeRestart(ctx context.Context, uptime time.Duration, killed bool, state *ProcessState, hooks ProcessHooks, gaveUp func()) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	delay, giveUp := b.base, false
+	if !killed {
+		delay, giveUp = b.Failed(uptime)
+		if b.EnteredRestartLoop() {
+			hooks.Send(EventRestartLoop, map[string]interface{}{"failures": b.failures})
+		}
+	}
+	if giveUp {
+		gaveUp()
+		state.GiveUp()
+		hooks.Send(EventGaveUp, map[string]interface{}{"failures": b.giveUp})
+	}
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
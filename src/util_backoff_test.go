@@ -0,0 +1,93 @@
+package autotee
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelays(t *testing.T) {
+	times := DefaultTimeConfig
+	times.RestartMaxDelay = 10 * time.Second
+	times.RestartHealthyTime = 30 * time.Second
+	misc := DefaultMiscConfig
+
+	b := NewBackoff(3*time.Second, &times, &misc)
+
+	// Delays double up to the maximum.
+	for _, expected := range []time.Duration{3, 6, 10, 10} {
+		delay, giveUp := b.Failed(time.Second)
+		if giveUp {
+			t.Fatal("Backoff should not give up")
+		}
+		if delay != expected*time.Second {
+			t.Fatalf("Delay was %v, expected %v", delay, expected*time.Second)
+		}
+	}
+
+	// After a healthy run, they start over.
+	if delay, _ := b.Failed(time.Minute); delay != 3*time.Second {
+		t.Fatalf("Delay was %v, expected 3s", delay)
+	}
+}
+
+func TestBackoffFixedDelay(t *testing.T) {
+	times := DefaultTimeConfig
+	misc := DefaultMiscConfig
+	misc.RestartJitter = 50
+
+	b := NewBackoff(4*time.Second, &times, &misc)
+
+	for i := 0; i < 10; i++ {
+		delay, giveUp := b.Failed(0)
+		if giveUp {
+			t.Fatal("Backoff should not give up")
+		}
+		if delay < 2*time.Second || delay > 4*time.Second {
+			t.Fatalf("Delay was %v, expected between 2s and 4s", delay)
+		}
+	}
+}
+
+func TestBackoffRestartLoop(t *testing.T) {
+	times := DefaultTimeConfig
+	misc := DefaultMiscConfig
+	misc.RestartLoopFailures = 2
+
+	b := NewBackoff(time.Second, &times, &misc)
+
+	// Reported once, when the failures reach the threshold.
+	for i, expected := range []bool{false, true, false, false} {
+		if b.Failed(0); b.EnteredRestartLoop() != expected {
+			t.Fatalf("Failure %d: EnteredRestartLoop was %v, expected %v", i, !expected, expected)
+		}
+	}
+
+	// After a healthy run, it counts again.
+	if b.Failed(time.Hour); b.EnteredRestartLoop() {
+		t.Fatal("Healthy run should not be a restart loop")
+	}
+	if b.Failed(0); !b.EnteredRestartLoop() {
+		t.Fatal("Restart loop should have been reported again")
+	}
+}
+
+func TestBackoffGiveUp(t *testing.T) {
+	times := DefaultTimeConfig
+	misc := DefaultMiscConfig
+	misc.GiveUpFailures = 3
+
+	b := NewBackoff(time.Second, &times, &misc)
+
+	for i, expected := range []bool{false, false, true, false, false, true} {
+		if _, giveUp := b.Failed(0); giveUp != expected {
+			t.Fatalf("Failure %d: giveUp was %v, expected %v", i, giveUp, expected)
+		}
+	}
+
+	// Healthy runs don't count.
+	b.Failed(0)
+	b.Failed(0)
+	if _, giveUp := b.Failed(time.Hour); giveUp {
+		t.Fatal("Backoff should not give up after a healthy run")
+	}
+}
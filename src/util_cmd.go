@@ -2,6 +2,7 @@ package autotee
 
 import (
 	"io"
+	"os"
 	"os/exec"
 	"runtime"
 	"syscall"
@@ -10,12 +11,22 @@ import (
 	"github.com/juju/errors"
 )
 
+// How long the stderr output of a process that exited is still copied,
+// for children that inherited stderr and keep it open.
+const stderrDrainTime = time.Second
+
 type Cmd struct {
 	cmd *exec.Cmd
 
 	waitBegin  chan struct{}
 	waitDone   chan struct{}
 	waitResult chan error
+
+	// Set by TeeStderr.
+	stderrRead    *os.File
+	stderrWrite   *os.File
+	stderrWriters []io.Writer
+	stderrDone    chan struct{}
 }
 
 func Command(name string, args ...string) *Cmd {
@@ -52,7 +63,12 @@ func Command(name string, args ...string) *Cmd {
 		Pdeathsig: syscall.SIGKILL,
 	}
 
-	return &Cmd{c, make(chan struct{}), make(chan struct{}), make(chan error, 1)}
+	return &Cmd{
+		cmd:        c,
+		waitBegin:  make(chan struct{}),
+		waitDone:   make(chan struct{}),
+		waitResult: make(chan error, 1),
+	}
 }
 
 func (c *Cmd) Start() error {
@@ -61,7 +77,14 @@ func (c *Cmd) Start() error {
 	go func() {
 		runtime.LockOSThread()
 
-		if err := c.cmd.Start(); err != nil {
+		err := c.cmd.Start()
+		if c.stderrWrite != nil {
+			c.stderrWrite.Close() // the process has its own copy
+		}
+		if err != nil {
+			if c.stderrRead != nil {
+				c.stderrRead.Close()
+			}
 			startResult <- errors.Trace(err)
 			close(startResult)
 			return
@@ -69,10 +92,17 @@ func (c *Cmd) Start() error {
 			close(startResult)
 		}
 
+		if c.stderrRead != nil {
+			c.stderrDone = make(chan struct{})
+			go copyStderr(c.stderrRead, c.stderrWriters, c.stderrDone)
+		}
+
 		<-c.waitBegin
 
 		close(c.waitDone)
-		c.waitResult <- errors.Trace(c.cmd.Wait())
+		err = c.cmd.Wait()
+		c.drainStderr()
+		c.waitResult <- errors.Trace(err)
 		close(c.waitResult)
 	}()
 
@@ -108,10 +138,69 @@ func (c *Cmd) SetStdin(r io.Reader) {
 	c.cmd.Stdin = r
 }
 
+func (c *Cmd) SetStdout(w io.Writer) {
+	c.cmd.Stdout = w
+}
+
 func (c *Cmd) SetStderr(w io.Writer) {
 	c.cmd.Stderr = w
 }
 
+// TeeStderr copies the stderr output of the process to all writers.
+//
+// Unlike with SetStderr(io.MultiWriter(...)), a writer that fails (like the
+// screen of a terminal that is gone) doesn't affect the other writers or the
+// process. Writers with a Flush method are flushed when the output ends.
+//
+// The process gets the write end of a pipe, so waiting for it doesn't wait
+// for children that inherited stderr longer than stderrDrainTime.
+func (c *Cmd) TeeStderr(writers ...io.Writer) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.cmd.Stderr = w
+	c.stderrRead, c.stderrWrite, c.stderrWriters = r, w, writers
+	return nil
+}
+
+func copyStderr(r *os.File, writers []io.Writer, done chan<- struct{}) {
+	defer close(done)
+	defer r.Close()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		for _, w := range writers {
+			_, _ = w.Write(buf[:n]) // ignore errors, see TeeStderr
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	for _, w := range writers {
+		if flusher, ok := w.(interface {
+			Flush()
+		}); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// drainStderr waits until the stderr output of the exited process is copied.
+func (c *Cmd) drainStderr() {
+	if c.stderrDone == nil {
+		return
+	}
+	select {
+	case <-c.stderrDone:
+	case <-time.After(stderrDrainTime):
+		c.stderrRead.Close() // interrupts the read
+		<-c.stderrDone
+	}
+}
+
 func (c *Cmd) KillGroup() error {
 	pgid, err := syscall.Getpgid(c.cmd.Process.Pid)
 	if err != nil {
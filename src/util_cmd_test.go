@@ -0,0 +1,53 @@
+package autotee
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("gone") }
+
+func TestCmdTeeStderr(t *testing.T) {
+	ring := NewLineRing(10)
+
+	cmd := Command("sh", "-c", "echo one >&2; echo two >&2")
+	if err := cmd.TeeStderr(failingWriter{}, ring); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-cmd.WaitChannel(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing writer doesn't affect the others or the process
+	if lines := ring.Lines(); len(lines) != 2 || lines[0] != "one" || lines[1] != "two" {
+		t.Fatalf("Lines were %#v", lines)
+	}
+}
+
+func TestCmdTeeStderrInherited(t *testing.T) {
+	ring := NewLineRing(10)
+
+	// The child keeps stderr open after the process exited
+	cmd := Command("sh", "-c", "sleep 5 & echo done >&2")
+	if err := cmd.TeeStderr(ring); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-cmd.WaitChannel():
+	case <-time.After(stderrDrainTime + time.Second):
+		t.Fatal("Waiting should not wait for the child")
+	}
+	if lines := ring.Lines(); len(lines) != 1 || lines[0] != "done" {
+		t.Fatalf("Lines were %#v", lines)
+	}
+}
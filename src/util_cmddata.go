@@ -3,6 +3,7 @@ package autotee
 import (
 	"bytes"
 	"strconv"
+	"strings"
 
 	"github.com/juju/errors"
 	"github.com/mattn/go-shellwords"
@@ -28,19 +29,89 @@ func NewCmdData(line string) (cd CmdData, err error) {
 	return CmdData{args[0], args[1:]}, nil
 }
 
+// Replace substitutes placeholders like "{stream}" anywhere in the arguments.
+// The program name is kept as it is.
+//
+// The keys of the replacements map include the braces.
+// Literal braces are written as "{{" and "}}".
+// Replace can't fail: the command must have been checked with Validate,
+// with the same keys (the values don't matter).
 func (cd *CmdData) Replace(replacements map[string]string) (result CmdData) {
 	result.Name = cd.Name
 	result.Args = make([]string, len(cd.Args))
-	for i, _ := range cd.Args {
-		result.Args[i] = cd.Args[i]
-		for old, new := range replacements {
-			if result.Args[i] == old {
-				result.Args[i] = new
-				break
+	for i, arg := range cd.Args {
+		result.Args[i] = interpolate(arg, replacements, nil)
+	}
+	return
+}
+
+// Validate checks that the program name has no placeholders, which would let
+// stream names choose the program, and that all placeholders in the arguments
+// are known and all literal braces are escaped.
+func (cd *CmdData) Validate(replacements map[string]string) error {
+	if strings.ContainsAny(cd.Name, "{}") {
+		return errors.Errorf("program must not contain placeholders or braces: %#v", cd.Name)
+	}
+
+	var err error
+	for _, arg := range cd.Args {
+		interpolate(arg, replacements, &err)
+		if err != nil {
+			return errors.Annotatef(err, "invalid argument %#v", arg)
+		}
+	}
+	return nil
+}
+
+// interpolate substitutes the placeholders in s.
+//
+// Unknown placeholders and unescaped braces are kept as they are,
+// and the first of them is reported in *err, unless err is nil.
+func interpolate(s string, replacements map[string]string, err *error) string {
+	var buffer bytes.Buffer
+
+	report := func(e error) {
+		if err != nil && *err == nil {
+			*err = e
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			buffer.WriteByte('{')
+			i++
+
+		case strings.HasPrefix(s[i:], "}}"):
+			buffer.WriteByte('}')
+			i++
+
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				report(errors.New("unterminated placeholder (use {{ for a literal brace)"))
+				buffer.WriteByte(s[i])
+				continue
 			}
+			placeholder := s[i : i+end+1]
+			value, ok := replacements[placeholder]
+			if !ok {
+				report(errors.Errorf("unknown placeholder %s", placeholder))
+				value = placeholder
+			}
+			buffer.WriteString(value)
+			i += end
+
+		case s[i] == '}':
+			report(errors.New("unmatched } (use }} for a literal brace)"))
+			buffer.WriteByte(s[i])
+
+		default:
+			buffer.WriteByte(s[i])
 		}
 	}
-	return
+
+	return buffer.String()
 }
 
 func (cd *CmdData) NewCmd() *Cmd {
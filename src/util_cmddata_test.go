@@ -0,0 +1,70 @@
+package autotee
+
+import (
+	"testing"
+)
+
+func TestCmdDataReplace(t *testing.T) {
+	vars := map[string]string{
+		"{stream}": "s1_native_hd",
+		"{1}":      "1",
+	}
+
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{"{stream}", "s1_native_hd"},
+		{"rtmp://localhost/stream/{stream}", "rtmp://localhost/stream/s1_native_hd"},
+		{"--output=/rec/{stream}.ts", "--output=/rec/s1_native_hd.ts"},
+		{"room{1}-{stream}", "room1-s1_native_hd"},
+		{"{{stream}}", "{stream}"},
+		{"{{{stream}}}", "{s1_native_hd}"},
+		{"awk '{{print $1}}'", "awk '{print $1}'"},
+		{"plain", "plain"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		cd := CmdData{"cmd", []string{test.arg}}
+		if err := cd.Validate(vars); err != nil {
+			t.Fatalf("Validate(%#v) failed: %s", test.arg, err)
+		}
+		result := cd.Replace(vars)
+		if result.Args[0] != test.expected {
+			t.Fatalf("Replace(%#v) was %#v, expected %#v", test.arg, result.Args[0], test.expected)
+		}
+	}
+}
+
+func TestCmdDataReplaceName(t *testing.T) {
+	vars := map[string]string{
+		"{stream}": "s1_native_hd",
+	}
+
+	cd := CmdData{"/opt/{stream}/record", []string{"{stream}"}}
+	if err := cd.Validate(vars); err == nil {
+		t.Fatal("Validate should have failed for a placeholder in the program")
+	}
+	if result := cd.Replace(vars); result.Name != "/opt/{stream}/record" {
+		t.Fatalf("Replace gave program %#v, expected it unchanged", result.Name)
+	}
+
+	cd = CmdData{"/opt/{{literal}}/record", nil}
+	if err := cd.Validate(vars); err == nil {
+		t.Fatal("Validate should have failed for braces in the program")
+	}
+}
+
+func TestCmdDataValidate(t *testing.T) {
+	vars := map[string]string{
+		"{stream}": "s1_native_hd",
+	}
+
+	for _, arg := range []string{"{unknown}", "x{unknown}x", "{stream", "stream}", "{", "}"} {
+		cd := CmdData{"cmd", []string{arg}}
+		if err := cd.Validate(vars); err == nil {
+			t.Fatalf("Validate(%#v) should have failed", arg)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package autotee
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LogWriter is an io.Writer that logs each line written to it as an entry.
+//
+// Thread-safe.
+type LogWriter struct {
+	lock     sync.Mutex
+	entry    *log.Entry
+	splitter lineSplitter
+}
+
+func NewLogWriter(entry *log.Entry) *LogWriter {
+	return &LogWriter{
+		entry: entry.WithField("output", "stderr"),
+	}
+}
+
+// Write never fails.
+func (lw *LogWriter) Write(p []byte) (int, error) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	lw.splitter.write(p, lw.log)
+	return len(p), nil
+}
+
+// Flush logs an incomplete last line, if there is one.
+func (lw *LogWriter) Flush() {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	if len(lw.splitter.partial) > 0 {
+		lw.log(lw.splitter.take())
+	}
+}
+
+func (lw *LogWriter) log(line string) {
+	lw.entry.Info(line)
+}
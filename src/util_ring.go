@@ -0,0 +1,107 @@
+package autotee
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Lines longer than this are split.
+const maxLineLength = 4096
+
+// lineSplitter splits text that is written in arbitrary pieces into lines.
+//
+// Not thread-safe.
+type lineSplitter struct {
+	// Incomplete last line.
+	partial []byte
+}
+
+// write calls line for each line that p completes, without the line ending.
+func (ls *lineSplitter) write(p []byte, line func(string)) {
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			ls.partial = append(ls.partial, rest...)
+			if len(ls.partial) >= maxLineLength {
+				line(ls.take())
+			}
+			break
+		}
+		ls.partial = append(ls.partial, rest[:i]...)
+		line(ls.take())
+		rest = rest[i+1:]
+	}
+}
+
+// take returns the incomplete last line and forgets it.
+func (ls *lineSplitter) take() string {
+	line := string(bytes.TrimRight(ls.partial, "\r"))
+	ls.partial = ls.partial[:0]
+	return line
+}
+
+// LineRing is an io.Writer that remembers the last lines written to it.
+//
+// Thread-safe.
+type LineRing struct {
+	lock sync.Mutex
+
+	// Ring buffer of complete lines; lines[start] is the oldest one.
+	lines []string
+	start int
+
+	splitter lineSplitter
+}
+
+// NewLineRing returns a LineRing that keeps at most maxLines lines.
+func NewLineRing(maxLines int) *LineRing {
+	return &LineRing{
+		lines: make([]string, 0, maxLines),
+	}
+}
+
+// Write never fails.
+func (lr *LineRing) Write(p []byte) (int, error) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	lr.splitter.write(p, lr.add)
+	return len(p), nil
+}
+
+// Lines returns the remembered lines, oldest first,
+// including an incomplete last line.
+func (lr *LineRing) Lines() []string {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	result := make([]string, 0, len(lr.lines)+1)
+	result = append(result, lr.lines[lr.start:]...)
+	result = append(result, lr.lines[:lr.start]...)
+	if len(lr.splitter.partial) > 0 {
+		result = append(result, string(lr.splitter.partial))
+	}
+	return result
+}
+
+// Tail returns the last n lines, oldest first.
+func (lr *LineRing) Tail(n int) []string {
+	lines := lr.Lines()
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// Must be called with the lock held.
+func (lr *LineRing) add(line string) {
+	switch {
+	case cap(lr.lines) == 0:
+	case len(lr.lines) < cap(lr.lines):
+		lr.lines = append(lr.lines, line)
+	default:
+		lr.lines[lr.start] = line
+		lr.start = (lr.start + 1) % len(lr.lines)
+	}
+}
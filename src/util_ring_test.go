@@ -0,0 +1,32 @@
+package autotee
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineRing(t *testing.T) {
+	lr := NewLineRing(3)
+
+	lr.Write([]byte("one\ntw"))
+	lr.Write([]byte("o\r\nthree\nfour\nfi"))
+
+	expected := []string{"two", "three", "four", "fi"}
+	if lines := lr.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, lines)
+	}
+
+	expected = []string{"four", "fi"}
+	if lines := lr.Tail(2); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, lines)
+	}
+}
+
+func TestLineRingEmpty(t *testing.T) {
+	lr := NewLineRing(0)
+	lr.Write([]byte("one\ntwo\n"))
+
+	if lines := lr.Lines(); len(lines) != 0 {
+		t.Errorf("Expected no lines, got %#v", lines)
+	}
+}
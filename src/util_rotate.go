@@ -0,0 +1,94 @@
+package autotee
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// RotatingFile is an append-only file that is rotated when it gets too large.
+//
+// When writing would make the file larger than maxSize bytes, it is renamed
+// to path.1 (path.1 to path.2, and so on, keeping at most maxFiles old files)
+// and a new file is started. A maxSize of 0 disables rotation.
+//
+// Thread-safe.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0755); err != nil {
+		return errors.Annotatef(err, "failed to create directory for log file %s", rf.path)
+	}
+
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Annotatef(err, "failed to open log file %s", rf.path)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Trace(err)
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Must be called with the lock held.
+func (rf *RotatingFile) rotate() error {
+	rf.file.Close()
+
+	if rf.maxFiles > 0 {
+		for i := rf.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		os.Rename(rf.path, rf.path+".1")
+	} else {
+		os.Remove(rf.path)
+	}
+
+	return rf.open()
+}
@@ -34,16 +34,3 @@ func (st *RestartableTimer) Restart() {
 	}
 	st.timer.Reset(st.duration)
 }
-
-// Like time.Tick, but the first tick comes immediately.
-func TickNow(d time.Duration) <-chan time.Time {
-	channel := make(chan time.Time)
-	go func() {
-		tick := time.Tick(d)
-		channel <- time.Now()
-		for now := range tick {
-			channel <- now
-		}
-	}()
-	return channel
-}
@@ -0,0 +1,227 @@
+package autotee
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Events sent to webhooks.
+const (
+	EventStreamAdded   = "stream_added"
+	EventStreamRemoved = "stream_removed"
+	EventFlowStarted   = "flow_started"
+	EventSourceDied    = "source_died"
+	EventSinkDied      = "sink_died"
+	EventSinkStalled   = "sink_stalled"
+	EventRestartLoop   = "restart_loop"
+	EventGaveUp        = "gave_up"
+)
+
+var AllEvents = []string{
+	EventStreamAdded,
+	EventStreamRemoved,
+	EventFlowStarted,
+	EventSourceDied,
+	EventSinkDied,
+	EventSinkStalled,
+	EventRestartLoop,
+	EventGaveUp,
+}
+
+// Event is what webhooks receive, as JSON.
+type Event struct {
+	Event   string                 `json:"event"`
+	Time    time.Time              `json:"time"`
+	Server  string                 `json:"server,omitempty"`
+	Stream  string                 `json:"stream,omitempty"`
+	Flow    string                 `json:"flow,omitempty"`
+	Sink    string                 `json:"sink,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Webhooks sends events to the configured webhooks.
+//
+// Each webhook has a bounded queue, worked off by its own goroutine.
+// When the queue is full, events are dropped, so sending never blocks.
+//
+// A nil *Webhooks is valid and drops all events.
+// Thread-safe.
+type Webhooks struct {
+	lock  sync.RWMutex
+	hooks []*webhook
+}
+
+type webhook struct {
+	config WebhookConfig
+	log    *log.Entry
+	client http.Client
+	queue  chan Event
+	events map[string]bool
+
+	droppedMetric metrics.Counter
+}
+
+// ProcessHooks sends events about one process (or flow, or stream).
+type ProcessHooks struct {
+	hooks *Webhooks
+	id    ProcessId
+}
+
+func NewWebhooks(configs []WebhookConfig) *Webhooks {
+	w := &Webhooks{}
+	w.Update(configs)
+	return w
+}
+
+// Update replaces the configured webhooks.
+// Events already queued for the old ones are still sent.
+func (w *Webhooks) Update(configs []WebhookConfig) {
+	hooks := make([]*webhook, 0, len(configs))
+	for i, config := range configs {
+		hooks = append(hooks, newWebhook(i, config))
+	}
+
+	w.lock.Lock()
+	old := w.hooks
+	w.hooks = hooks
+	w.lock.Unlock()
+
+	for _, hook := range old {
+		close(hook.queue)
+	}
+}
+
+// Send queues an event for all webhooks that want it.
+//
+// Doesn't block.
+func (w *Webhooks) Send(event Event) {
+	if w == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	for _, hook := range w.hooks {
+		hook.send(event)
+	}
+}
+
+// For returns a ProcessHooks that sends events about a process.
+func (w *Webhooks) For(id ProcessId) ProcessHooks {
+	return ProcessHooks{w, id}
+}
+
+// Send queues an event about the process.
+//
+// Doesn't block.
+func (ph ProcessHooks) Send(event string, details map[string]interface{}) {
+	ph.hooks.Send(Event{
+		Event:   event,
+		Server:  ph.id.Server,
+		Stream:  ph.id.Stream,
+		Flow:    ph.id.Flow,
+		Sink:    ph.id.Sink,
+		Details: details,
+	})
+}
+
+// newWebhook starts the i-th webhook. It is named after its index,
+// unless it has a name: the URL must not end up in metrics and logs.
+func newWebhook(i int, config WebhookConfig) *webhook {
+	name := config.Name
+	if name == "" {
+		name = strconv.Itoa(i)
+	}
+
+	hook := &webhook{
+		config: config,
+		log: log.WithFields(log.Fields{
+			"webhook": name,
+			"url":     redactUrl(config.Url),
+		}),
+		client: http.Client{Timeout: config.Timeout},
+		queue:  make(chan Event, config.QueueSize),
+
+		droppedMetric: metrics.GetOrRegister(MetricLabels{"webhook": name}.Name("webhook.dropped"), metrics.NewCounter()).(metrics.Counter),
+	}
+
+	if len(config.Events) > 0 {
+		hook.events = make(map[string]bool, len(config.Events))
+		for _, event := range config.Events {
+			hook.events[event] = true
+		}
+	}
+
+	go hook.run()
+	return hook
+}
+
+func (h *webhook) send(event Event) {
+	if h.events != nil && !h.events[event.Event] {
+		return
+	}
+
+	select {
+	case h.queue <- event:
+	default:
+		h.droppedMetric.Inc(1)
+		h.log.WithField("event", event.Event).Warn("Webhook queue full, dropping event")
+	}
+}
+
+// run sends queued events until the queue is closed.
+func (h *webhook) run() {
+	for event := range h.queue {
+		if err := h.post(event); err != nil {
+			h.log.WithField("event", event.Event).WithError(err).Warn("Webhook failed")
+		}
+	}
+}
+
+func (h *webhook) post(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	resp, err := h.client.Post(h.config.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = redactUrl(urlErr.URL)
+		}
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// redactUrl leaves out the user info, query and fragment of a URL,
+// where secrets like passwords and tokens usually are.
+func redactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "(invalid)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	return u.String()
+}